@@ -0,0 +1,178 @@
+package bob_helpers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/dialect"
+	"github.com/stephenafamo/bob/dialect/psql/um"
+	"github.com/stephenafamo/bob/orm"
+	"github.com/top-solution/go-libs/v2/keys"
+)
+
+// AuditColumns names the audit columns of a table: leave a field empty when the table doesn't have that column
+type AuditColumns struct {
+	// CreatedAt and CreatedBy are set on insert, unless already set
+	CreatedAt string
+	CreatedBy string
+	// UpdatedAt and UpdatedBy are set on insert, unless already set, and on every update
+	UpdatedAt string
+	UpdatedBy string
+	// DeletedAt marks soft-deleted rows: they're filtered out of select queries unless WithDeleted is used
+	DeletedAt string
+}
+
+// DefaultAuditColumns are the audit columns most of our tables have
+var DefaultAuditColumns = AuditColumns{
+	CreatedAt: "created_at",
+	CreatedBy: "created_by",
+	UpdatedAt: "updated_at",
+	DeletedAt: "deleted_at",
+}
+
+// now is replaced in tests
+var now = time.Now
+
+type withDeletedKey struct{}
+
+// WithDeleted returns a context in which soft-deleted rows are not filtered out by the audit hooks and NotDeleted
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedKey{}, true)
+}
+
+// isWithDeleted reports whether ctx was returned by WithDeleted
+func isWithDeleted(ctx context.Context) bool {
+	withDeleted, _ := ctx.Value(withDeletedKey{}).(bool)
+	return withDeleted
+}
+
+// RegisterAuditHooks registers the hooks managing the audit columns of a bob table, i.e. models.Users:
+//   - select queries skip the soft-deleted rows, unless run with WithDeleted(ctx)
+//   - inserts set the created and updated columns, unless already set by the setter
+//   - updates set the updated columns, which must not be set by the setter
+//
+// The user columns are set to keys.SubjectFromContext(ctx)
+// It's meant to be called once per table, i.e. from an init() function
+func RegisterAuditHooks[T any, Tslice ~[]T, Tset orm.Setter[T, *dialect.InsertQuery, *dialect.UpdateQuery], C bob.Expression](table *psql.Table[T, Tslice, Tset, C], columns AuditColumns) {
+	if columns.DeletedAt != "" {
+		table.SelectQueryHooks.AppendHooks(func(ctx context.Context, _ bob.Executor, q *dialect.SelectQuery) (context.Context, error) {
+			if !isWithDeleted(ctx) {
+				q.AppendWhere(psql.Quote(table.Alias(), columns.DeletedAt).IsNull())
+			}
+			return ctx, nil
+		})
+	}
+
+	table.BeforeInsertHooks.AppendHooks(func(ctx context.Context, _ bob.Executor, setter Tset) (context.Context, error) {
+		timestamp := now()
+		subject := keys.SubjectFromContext(ctx)
+		for column, value := range map[string]any{
+			columns.CreatedAt: timestamp,
+			columns.UpdatedAt: timestamp,
+			columns.CreatedBy: subject,
+			columns.UpdatedBy: subject,
+		} {
+			if column == "" {
+				continue
+			}
+			err := setUnsetField(setter, column, value)
+			if err != nil {
+				return ctx, fmt.Errorf("audit column %s: %w", column, err)
+			}
+		}
+		return ctx, nil
+	})
+
+	table.UpdateQueryHooks.AppendHooks(func(ctx context.Context, _ bob.Executor, q *dialect.UpdateQuery) (context.Context, error) {
+		if columns.UpdatedAt != "" {
+			um.SetCol(columns.UpdatedAt).ToArg(now()).Apply(q)
+		}
+		if columns.UpdatedBy != "" {
+			um.SetCol(columns.UpdatedBy).ToArg(keys.SubjectFromContext(ctx)).Apply(q)
+		}
+		return ctx, nil
+	})
+}
+
+// NotDeleted filters out the soft-deleted rows of hand-written select queries, unless run with WithDeleted(ctx)
+// column is the (optionally qualified) soft-delete column, i.e. NotDeleted("users", "deleted_at")
+func NotDeleted(column ...string) bob.Mod[*dialect.SelectQuery] {
+	return bob.ModFunc[*dialect.SelectQuery](func(q *dialect.SelectQuery) {
+		q.AppendContextualModFunc(func(ctx context.Context, q *dialect.SelectQuery) (context.Context, error) {
+			if !isWithDeleted(ctx) {
+				q.AppendWhere(psql.Quote(column...).IsNull())
+			}
+			return ctx, nil
+		})
+	})
+}
+
+// SoftDelete marks the rows matched by an update query as deleted, setting column to the current time
+// Example usage: models.Users.Update(bob_helpers.SoftDelete("deleted_at"), um.Where(...)).Exec(ctx, exec)
+func SoftDelete(column string) bob.Mod[*dialect.UpdateQuery] {
+	return bob.ModFunc[*dialect.UpdateQuery](func(q *dialect.UpdateQuery) {
+		um.SetCol(column).ToArg(now()).Apply(q)
+	})
+}
+
+// setUnsetField sets the setter field mapped to column, unless it's already set
+// Setter fields are either omit/omitnull values, as generated by bob, or pointers
+func setUnsetField(setter any, column string, value any) error {
+	v := reflect.ValueOf(setter)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("setter must be a pointer to a struct, got %T", setter)
+	}
+	v = v.Elem()
+
+	for i := range v.NumField() {
+		tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("db"), ",")
+		if tag != column {
+			continue
+		}
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Pointer {
+			if !field.IsNil() {
+				return nil
+			}
+			val, err := convertTo(value, field.Type().Elem())
+			if err != nil {
+				return err
+			}
+			ptr := reflect.New(field.Type().Elem())
+			ptr.Elem().Set(val)
+			field.Set(ptr)
+			return nil
+		}
+
+		isUnset := field.MethodByName("IsUnset")
+		set := field.Addr().MethodByName("Set")
+		if !isUnset.IsValid() || !set.IsValid() {
+			return fmt.Errorf("unsupported setter field type %s", field.Type())
+		}
+		if !isUnset.Call(nil)[0].Bool() {
+			return nil
+		}
+		val, err := convertTo(value, set.Type().In(0))
+		if err != nil {
+			return err
+		}
+		set.Call([]reflect.Value{val})
+		return nil
+	}
+	// The table doesn't have the column after all
+	return nil
+}
+
+func convertTo(value any, typ reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(value)
+	if !v.Type().ConvertibleTo(typ) {
+		return v, fmt.Errorf("can't assign %T to %s", value, typ)
+	}
+	return v.Convert(typ), nil
+}
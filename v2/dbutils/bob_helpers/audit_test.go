@@ -0,0 +1,93 @@
+package bob_helpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aarondl/opt/omit"
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+	"github.com/stephenafamo/bob/dialect/psql/um"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+	"github.com/top-solution/go-libs/v2/keys"
+)
+
+// auditItems has its own hooks, not to affect the other tests using testutil.Item
+var auditItems = testutil.NewItemsTable()
+
+func init() {
+	RegisterAuditHooks(auditItems, DefaultAuditColumns)
+}
+
+// buildWithHooks runs the query hooks, then builds the query as bob would before executing it
+func buildWithHooks(t *testing.T, ctx context.Context, q interface {
+	bob.Query
+	RunHooks(context.Context, bob.Executor) (context.Context, error)
+}) (string, []any) {
+	ctx, err := q.RunHooks(ctx, nil)
+	require.NoError(t, err)
+	query, args, err := bob.Build(ctx, q)
+	require.NoError(t, err)
+	return query, args
+}
+
+func TestAuditHooks(t *testing.T) {
+	fixedNow := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now = func() time.Time { return fixedNow }
+	defer func() { now = time.Now }()
+	ctx := context.WithValue(context.Background(), keys.RequestSubjectKey, "john")
+
+	query, _ := buildWithHooks(t, ctx, auditItems.Query())
+	assert.Contains(t, query, `WHERE ("items"."deleted_at" IS NULL)`)
+
+	query, _ = buildWithHooks(t, WithDeleted(ctx), auditItems.Query())
+	assert.NotContains(t, query, "deleted_at\" IS NULL")
+
+	// The generated setters run the insert hooks when applied: testutil.ItemSetter leaves it to the caller
+	createdAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	setter := &testutil.ItemSetter{Name: omit.From("Jane"), CreatedAt: omit.From(createdAt)}
+	_, err := auditItems.BeforeInsertHooks.RunHooks(ctx, nil, setter)
+	require.NoError(t, err)
+	_, args := buildWithHooks(t, ctx, auditItems.Insert(setter))
+	require.Len(t, args, 4)
+	// Values set by the caller are kept
+	assert.Equal(t, createdAt, setter.CreatedAt.MustGet())
+	assert.Equal(t, "john", *setter.CreatedBy)
+	assert.Equal(t, fixedNow, setter.UpdatedAt.MustGet())
+
+	update := &testutil.ItemSetter{Name: omit.From("Janet")}
+	query, args = buildWithHooks(t, ctx, auditItems.Update(update.UpdateMod(), um.Where(psql.Quote("id").EQ(psql.Arg(1)))))
+	assert.Contains(t, query, `"updated_at" = $2`)
+	assert.Equal(t, fixedNow, args[1])
+}
+
+func TestNotDeletedAndSoftDelete(t *testing.T) {
+	ctx := context.Background()
+
+	query, _, err := bob.Build(ctx, psql.Select(sm.From("users"), NotDeleted("users", "deleted_at")))
+	require.NoError(t, err)
+	assert.Contains(t, query, `WHERE ("users"."deleted_at" IS NULL)`)
+
+	query, _, err = bob.Build(WithDeleted(ctx), psql.Select(sm.From("users"), NotDeleted("users", "deleted_at")))
+	require.NoError(t, err)
+	assert.NotContains(t, query, "WHERE")
+
+	query, args, err := bob.Build(ctx, psql.Update(um.Table("users"), SoftDelete("deleted_at"), um.Where(psql.Quote("id").EQ(psql.Arg(1)))))
+	require.NoError(t, err)
+	assert.Contains(t, query, `"deleted_at" = $1`)
+	assert.IsType(t, time.Time{}, args[0])
+}
+
+func TestSetUnsetFieldErrors(t *testing.T) {
+	err := setUnsetField(testutil.ItemSetter{}, "name", "x")
+	assert.ErrorContains(t, err, "must be a pointer to a struct")
+
+	err = setUnsetField(&testutil.ItemSetter{}, "created_at", "not a time")
+	assert.ErrorContains(t, err, "can't assign string")
+
+	assert.NoError(t, setUnsetField(&testutil.ItemSetter{}, "missing", "x"))
+}
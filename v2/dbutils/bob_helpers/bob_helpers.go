@@ -1,6 +1,7 @@
 package bob_helpers
 
 import (
+	"context"
 	"database/sql"
 	"reflect"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/stephenafamo/bob/dialect/psql/sm"
 	"github.com/stephenafamo/bob/expr"
 	"github.com/stephenafamo/scan"
+	"github.com/top-solution/go-libs/v2/dbutils"
 )
 
 // Ptr returns a pointer to the given value.
@@ -159,3 +161,21 @@ func (nullTypeConverter) TypeToDestination(typ reflect.Type) reflect.Value {
 func (nullTypeConverter) ValueFromDestination(val reflect.Value) reflect.Value {
 	return val.Elem().FieldByName("V").Elem().Elem()
 }
+
+// Executor adapts a dbutils.ContextExecutor (i.e. the result of dbutils.TxOr, or an instrumented executor) to a bob.Executor
+func Executor(exec dbutils.ContextExecutor) bob.Executor {
+	return executor{exec}
+}
+
+type executor struct {
+	dbutils.ContextExecutor
+}
+
+func (e executor) QueryContext(ctx context.Context, query string, args ...any) (scan.Rows, error) {
+	rows, err := e.ContextExecutor.QueryContext(ctx, query, args...)
+	if err != nil {
+		// A nil *sql.Rows would be wrapped in a non-nil scan.Rows
+		return nil, err
+	}
+	return rows, nil
+}
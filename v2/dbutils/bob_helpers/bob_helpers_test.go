@@ -0,0 +1,16 @@
+package bob_helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestExecutorQueryError(t *testing.T) {
+	rows, err := Executor(testutil.OpenSQLite(t)).QueryContext(context.Background(), "SELECT * FROM missing")
+	assert.Error(t, err)
+	// assert.Nil would accept a nil *sql.Rows wrapped in the interface
+	assert.True(t, rows == nil)
+}
@@ -0,0 +1,46 @@
+package bob_helpers
+
+import (
+	"reflect"
+
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/dialect"
+	"github.com/stephenafamo/bob/dialect/psql/um"
+)
+
+// ErrConflict is returned when a version-checked update finds the row modified by someone else
+// humautils.RegisterEndpoint maps it to a 412 Precondition Failed, see conflictError.PreconditionFailed
+var ErrConflict error = conflictError{}
+
+type conflictError struct{}
+
+func (conflictError) Error() string {
+	return "conflict: the row was modified concurrently"
+}
+
+// PreconditionFailed marks the error as a failed precondition, which humautils maps to 412 without importing bob_helpers
+func (conflictError) PreconditionFailed() bool {
+	return true
+}
+
+// CheckVersion makes an update query only match the rows whose version column still holds version
+// Integer versions are also incremented, while timestamp ones (i.e. updated_at) are expected to be set by the audit hooks
+// The update matches no rows on conflict: see Repository.UpdateVersioned, which turns that into ErrConflict
+func CheckVersion(column string, version any) bob.Mod[*dialect.UpdateQuery] {
+	return bob.ModFunc[*dialect.UpdateQuery](func(q *dialect.UpdateQuery) {
+		um.Where(psql.Quote(column).EQ(psql.Arg(version))).Apply(q)
+		if isInteger(version) {
+			um.SetCol(column).To(psql.Quote(column).OP("+", psql.Raw("1"))).Apply(q)
+		}
+	})
+}
+
+func isInteger(v any) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package bob_helpers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/aarondl/opt/omit"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/um"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/dbutils/ops/bobops"
+	"github.com/top-solution/go-libs/v2/humautils"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestCheckVersion(t *testing.T) {
+	query, args, err := bob.Build(context.Background(), psql.Update(um.Table("items"), um.SetCol("name").ToArg("John"), CheckVersion("version", 3)))
+	require.NoError(t, err)
+	assert.Contains(t, query, `"version" = ("version" + 1)`)
+	assert.Contains(t, query, `WHERE ("version" = $2)`)
+	assert.Equal(t, []any{"John", 3}, args)
+
+	query, _, err = bob.Build(context.Background(), psql.Update(um.Table("items"), um.SetCol("name").ToArg("John"), CheckVersion("updated_at", "2024-01-01")))
+	require.NoError(t, err)
+	assert.NotContains(t, query, `"updated_at" + 1`)
+	assert.Contains(t, query, `WHERE ("updated_at" = $2)`)
+}
+
+func TestUpdateVersioned(t *testing.T) {
+	sqlDB := testutil.OpenSQLite(t, testutil.ItemsTable)
+
+	repo, err := NewRepository[int](testutil.NewItemsTable(), bobops.NewBobFilterMap(map[string]string{"id": "items.id"}), sqlDB)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = repo.UpdateVersioned(ctx, 1, 1, &testutil.ItemSetter{Name: omit.From("Jane")})
+	assert.ErrorContains(t, err, "no version column")
+	repo.VersionColumn = "version"
+
+	item, err := repo.Insert(ctx, &testutil.ItemSetter{ID: omit.From(1), Name: omit.From("John"), Version: omit.From(1)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, item.Version)
+
+	item, err = repo.UpdateVersioned(ctx, 1, 1, &testutil.ItemSetter{Name: omit.From("Jane")})
+	require.NoError(t, err)
+	assert.Equal(t, &testutil.Item{ID: 1, Name: "Jane", Version: 2}, item)
+
+	// A stale version is a conflict, leaving the row untouched
+	_, err = repo.UpdateVersioned(ctx, 1, 1, &testutil.ItemSetter{Name: omit.From("Jim")})
+	assert.ErrorIs(t, err, ErrConflict)
+	var statusErr huma.StatusError
+	require.ErrorAs(t, humautils.ConflictToPreconditionFailed(err), &statusErr)
+	assert.Equal(t, http.StatusPreconditionFailed, statusErr.GetStatus())
+	item, err = repo.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane", item.Name)
+
+	_, err = repo.UpdateVersioned(ctx, 42, 1, &testutil.ItemSetter{Name: omit.From("Jim")})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NotErrorIs(t, err, ErrConflict)
+}
@@ -0,0 +1,181 @@
+package bob_helpers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/dialect"
+	"github.com/stephenafamo/bob/dialect/psql/dm"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+	"github.com/stephenafamo/bob/dialect/psql/um"
+	"github.com/stephenafamo/bob/expr"
+	"github.com/stephenafamo/bob/orm"
+	"github.com/top-solution/go-libs/v2/dbutils"
+	"github.com/top-solution/go-libs/v2/dbutils/ops"
+	"github.com/top-solution/go-libs/v2/humautils"
+)
+
+// crudTable is the subset of a bob table used by Repository
+type crudTable[T any, Tslice ~[]T] interface {
+	Alias() string
+	PrimaryKey() expr.ColumnsExpr
+	Query(queryMods ...bob.Mod[*dialect.SelectQuery]) *psql.ViewQuery[T, Tslice]
+	Insert(queryMods ...bob.Mod[*dialect.InsertQuery]) *orm.Query[*dialect.InsertQuery, T, Tslice, bob.SliceTransformer[T, Tslice]]
+	Update(queryMods ...bob.Mod[*dialect.UpdateQuery]) *orm.Query[*dialect.UpdateQuery, T, Tslice, bob.SliceTransformer[T, Tslice]]
+	Delete(queryMods ...bob.Mod[*dialect.DeleteQuery]) *orm.Query[*dialect.DeleteQuery, T, Tslice, bob.SliceTransformer[T, Tslice]]
+}
+
+// Filters maps the attributes of a FilterMap to the filters requested on them, i.e. {"name": {"like:john"}}
+type Filters map[string][]string
+
+// Repository implements the usual CRUD operations on a bob table with a single-column primary key of type ID
+// Every operation runs in the transaction from the context, if any, falling back to the repository executor
+type Repository[ID any, T any, Tslice ~[]T, Tset orm.Setter[T, *dialect.InsertQuery, *dialect.UpdateQuery]] struct {
+	table   crudTable[T, Tslice]
+	filters ops.FilterMap[bob.Mod[*dialect.SelectQuery]]
+	exec    dbutils.ContextExecutor
+	pk      psql.Expression
+
+	// SortMap maps the sort parameters to columns, when they differ from the filters ones (i.e. a generated SortColumnsMap)
+	SortMap *ops.FilterMap[bob.Mod[*dialect.SelectQuery]]
+	// VersionColumn is the column checked by UpdateVersioned, i.e. "version" or "updated_at"
+	VersionColumn string
+}
+
+// NewRepository returns a Repository on table, filtering lists with filters
+// Only ID must be given, i.e. NewRepository[int32](models.Users, ListUsersRequestColumnsMap, db)
+func NewRepository[ID any, T any, Tslice ~[]T, Tset orm.Setter[T, *dialect.InsertQuery, *dialect.UpdateQuery], C bob.Expression](
+	table *psql.Table[T, Tslice, Tset, C],
+	filters ops.FilterMap[bob.Mod[*dialect.SelectQuery]],
+	exec dbutils.ContextExecutor,
+) (*Repository[ID, T, Tslice, Tset], error) {
+	pk := table.PrimaryKey().Names()
+	if len(pk) != 1 {
+		return nil, fmt.Errorf("repository: table %s must have a single-column primary key, got %d columns", table.Alias(), len(pk))
+	}
+	return &Repository[ID, T, Tslice, Tset]{
+		table:   table,
+		filters: filters,
+		exec:    exec,
+		pk:      psql.Quote(table.Alias(), pk[0]),
+	}, nil
+}
+
+func (r *Repository[ID, T, Tslice, Tset]) executor(ctx context.Context) bob.Executor {
+	return Executor(dbutils.TxOr(ctx, r.exec))
+}
+
+// List returns a page of the rows matching filters, sorted by page.Sort, along with the pagination metadata of the response
+// page.Sort holds the sort parameters, i.e. "name" or "-name" for descending order, while a zero page.Limit means no limit
+func (r *Repository[ID, T, Tslice, Tset]) List(ctx context.Context, filters Filters, page humautils.PaginationParameters) (Tslice, humautils.PaginationMedia, error) {
+	media := humautils.PaginationMedia{Offset: page.Offset, Limit: page.Limit}
+
+	var mods []bob.Mod[*dialect.SelectQuery]
+	// Sort the attributes, so that the same filters always produce the same query
+	for _, attribute := range slices.Sorted(maps.Keys(filters)) {
+		err := r.filters.AddFilters(&mods, attribute, filters[attribute]...)
+		if err != nil {
+			return nil, media, err
+		}
+	}
+
+	exec := r.executor(ctx)
+	total, err := r.table.Query(mods...).Count(ctx, exec)
+	if err != nil {
+		return nil, media, fmt.Errorf("count %s: %w", r.table.Alias(), err)
+	}
+	media.Total = int(total)
+
+	sortMap := r.filters
+	if r.SortMap != nil {
+		sortMap = *r.SortMap
+	}
+	err = sortMap.AddSorting(&mods, page.Sort)
+	if err != nil {
+		return nil, media, err
+	}
+	if page.Limit > 0 {
+		mods = append(mods, sm.Limit(page.Limit))
+	}
+	if page.Offset > 0 {
+		mods = append(mods, sm.Offset(page.Offset))
+	}
+
+	items, err := r.table.Query(mods...).All(ctx, exec)
+	if err != nil {
+		return nil, media, fmt.Errorf("list %s: %w", r.table.Alias(), err)
+	}
+	if items == nil {
+		items = Tslice{}
+	}
+	return items, media, nil
+}
+
+// Get returns the row with the given primary key, or sql.ErrNoRows
+func (r *Repository[ID, T, Tslice, Tset]) Get(ctx context.Context, id ID) (T, error) {
+	item, err := r.table.Query(sm.Where(r.pk.EQ(psql.Arg(id)))).One(ctx, r.executor(ctx))
+	if err != nil {
+		return item, fmt.Errorf("get %s %v: %w", r.table.Alias(), id, err)
+	}
+	return item, nil
+}
+
+// Insert inserts a row, returning it as stored
+func (r *Repository[ID, T, Tslice, Tset]) Insert(ctx context.Context, setter Tset) (T, error) {
+	item, err := r.table.Insert(setter).One(ctx, r.executor(ctx))
+	if err != nil {
+		return item, fmt.Errorf("insert %s: %w", r.table.Alias(), err)
+	}
+	return item, nil
+}
+
+// Update updates the row with the given primary key, returning it as stored, or sql.ErrNoRows
+func (r *Repository[ID, T, Tslice, Tset]) Update(ctx context.Context, id ID, setter Tset) (T, error) {
+	item, err := r.table.Update(setter.UpdateMod(), um.Where(r.pk.EQ(psql.Arg(id)))).One(ctx, r.executor(ctx))
+	if err != nil {
+		return item, fmt.Errorf("update %s %v: %w", r.table.Alias(), id, err)
+	}
+	return item, nil
+}
+
+// UpdateVersioned is the same as Update, but it returns ErrConflict unless the version column of the row still holds version
+// See CheckVersion for the supported version columns
+func (r *Repository[ID, T, Tslice, Tset]) UpdateVersioned(ctx context.Context, id ID, version any, setter Tset) (T, error) {
+	if r.VersionColumn == "" {
+		var zero T
+		return zero, fmt.Errorf("update %s %v: no version column", r.table.Alias(), id)
+	}
+	item, err := r.table.Update(setter.UpdateMod(), um.Where(r.pk.EQ(psql.Arg(id))), CheckVersion(r.VersionColumn, version)).One(ctx, r.executor(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Tell a missing row apart from a conflict
+		_, err = r.Get(ctx, id)
+		if err != nil {
+			return item, err
+		}
+		err = ErrConflict
+	}
+	if err != nil {
+		return item, fmt.Errorf("update %s %v: %w", r.table.Alias(), id, err)
+	}
+	return item, nil
+}
+
+// Delete deletes the row with the given primary key, or returns sql.ErrNoRows
+// For soft-deletable tables, update the row with SoftDelete instead
+func (r *Repository[ID, T, Tslice, Tset]) Delete(ctx context.Context, id ID) error {
+	// The deleted rows are scanned rather than counted: not every driver reports the rows affected by a RETURNING statement
+	deleted, err := r.table.Delete(dm.Where(r.pk.EQ(psql.Arg(id)))).All(ctx, r.executor(ctx))
+	if err != nil {
+		return fmt.Errorf("delete %s %v: %w", r.table.Alias(), id, err)
+	}
+	if len(deleted) == 0 {
+		return fmt.Errorf("delete %s %v: %w", r.table.Alias(), id, sql.ErrNoRows)
+	}
+	return nil
+}
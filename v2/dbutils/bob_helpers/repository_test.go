@@ -0,0 +1,74 @@
+package bob_helpers
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/aarondl/opt/omit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/dbutils"
+	"github.com/top-solution/go-libs/v2/dbutils/ops/bobops"
+	"github.com/top-solution/go-libs/v2/humautils"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestRepository(t *testing.T) {
+	sqlDB := testutil.OpenSQLite(t, testutil.ItemsTable)
+
+	repo, err := NewRepository[int](testutil.NewItemsTable(), bobops.NewBobFilterMap(map[string]string{"id": "items.id", "name": "items.name"}), sqlDB)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i, name := range []string{"John", "Jane", "Jim"} {
+		item, err := repo.Insert(ctx, &testutil.ItemSetter{ID: omit.From(i + 1), Name: omit.From(name)})
+		require.NoError(t, err)
+		assert.Equal(t, &testutil.Item{ID: i + 1, Name: name, Version: 1}, item)
+	}
+
+	items, media, err := repo.List(ctx, nil, humautils.PaginationParameters{Limit: 2, Sort: []string{"-name"}})
+	require.NoError(t, err)
+	assert.Equal(t, humautils.PaginationMedia{Limit: 2, Offset: 0, Total: 3}, media)
+	assert.Equal(t, []*testutil.Item{{ID: 1, Name: "John", Version: 1}, {ID: 3, Name: "Jim", Version: 1}}, items)
+
+	items, media, err = repo.List(ctx, nil, humautils.PaginationParameters{Offset: 1, Limit: 2, Sort: []string{"-name"}})
+	require.NoError(t, err)
+	assert.Equal(t, humautils.PaginationMedia{Limit: 2, Offset: 1, Total: 3}, media)
+	assert.Equal(t, []*testutil.Item{{ID: 3, Name: "Jim", Version: 1}, {ID: 2, Name: "Jane", Version: 1}}, items)
+
+	items, media, err = repo.List(ctx, Filters{"name": {"eq:Jane"}}, humautils.PaginationParameters{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, media.Total)
+	assert.Equal(t, []*testutil.Item{{ID: 2, Name: "Jane", Version: 1}}, items)
+
+	items, media, err = repo.List(ctx, Filters{"name": {"eq:Nobody"}}, humautils.PaginationParameters{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, media.Total)
+	assert.NotNil(t, items)
+
+	_, _, err = repo.List(ctx, Filters{"missing": {"eq:1"}}, humautils.PaginationParameters{})
+	assert.Error(t, err)
+
+	item, err := repo.Update(ctx, 2, &testutil.ItemSetter{Name: omit.From("Janet")})
+	require.NoError(t, err)
+	assert.Equal(t, &testutil.Item{ID: 2, Name: "Janet", Version: 1}, item)
+	_, err = repo.Update(ctx, 42, &testutil.ItemSetter{Name: omit.From("Nobody")})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Operations honor the transaction in the context
+	err = dbutils.Transaction(ctx, sqlDB, func(ctx context.Context, tx *sql.Tx) error {
+		require.NoError(t, repo.Delete(ctx, 1))
+		_, err := repo.Get(ctx, 1)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		return sql.ErrTxDone
+	})
+	assert.ErrorIs(t, err, sql.ErrTxDone)
+
+	item, err = repo.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "John", item.Name)
+
+	require.NoError(t, repo.Delete(ctx, 1))
+	assert.ErrorIs(t, repo.Delete(ctx, 1), sql.ErrNoRows)
+}
@@ -0,0 +1,53 @@
+package bob_helpers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/top-solution/go-libs/v2/dbutils"
+	"github.com/top-solution/go-libs/v2/keys"
+)
+
+const (
+	// UserVariable is the transaction variable holding the current user, as set by ClaimsTxVariables
+	UserVariable = "app.user"
+	// TenantVariable is the transaction variable holding the current tenant, as set by ClaimsTxVariables
+	TenantVariable = "app.tenant"
+	// TenantClaim is the extra claim holding the tenant read by ClaimsTxVariables
+	TenantClaim = "tenant"
+)
+
+// TxVariablesExtractor returns the variables to set on the transactions begun with ctx
+type TxVariablesExtractor func(ctx context.Context) map[string]string
+
+// ClaimsTxVariables is the default TxVariablesExtractor: it sets app.user to the subject of keys.ClaimsFromContext,
+// and app.tenant to its tenant extra claim
+// Both are set even when empty, so that no stale value is left behind on MSSQL
+func ClaimsTxVariables(ctx context.Context) map[string]string {
+	claims := keys.ClaimsFromContext(ctx)
+	tenant := ""
+	if t, ok := claims.Extra[TenantClaim]; ok && t != nil {
+		tenant = fmt.Sprint(t)
+	}
+	return map[string]string{
+		UserVariable:   claims.Subject,
+		TenantVariable: tenant,
+	}
+}
+
+// RegisterRLS registers a transaction hook setting the variables extracted from the context on every transaction
+// begun by dbutils.Transaction, so that row-level security policies can rely on them:
+//
+//	CREATE POLICY tenant_isolation ON orders USING (tenant_id = current_setting('app.tenant', true));
+//
+// Pass a nil extract to use ClaimsTxVariables: see dbutils.SetTxVariables for the MSSQL equivalent
+// Queries run outside of dbutils.Transaction don't get the variables, so RLS policies should deny access without them
+func RegisterRLS(extract TxVariablesExtractor) {
+	if extract == nil {
+		extract = ClaimsTxVariables
+	}
+	dbutils.RegisterTxHook(func(ctx context.Context, tx *sql.Tx, driver dbutils.DriverType) error {
+		return dbutils.SetTxVariables(ctx, tx, driver, extract(ctx))
+	})
+}
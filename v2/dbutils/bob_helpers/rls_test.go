@@ -0,0 +1,18 @@
+package bob_helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/top-solution/go-libs/v2/keys"
+)
+
+func TestClaimsTxVariables(t *testing.T) {
+	assert.Equal(t, map[string]string{UserVariable: "", TenantVariable: ""}, ClaimsTxVariables(context.Background()))
+
+	claims := keys.Claims{Extra: map[string]interface{}{TenantClaim: "acme"}}
+	claims.Subject = "john"
+	ctx := context.WithValue(context.Background(), keys.RequestClaimsKey, claims)
+	assert.Equal(t, map[string]string{UserVariable: "john", TenantVariable: "acme"}, ClaimsTxVariables(ctx))
+}
@@ -0,0 +1,40 @@
+package bob_helpers
+
+import (
+	"context"
+	"iter"
+
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/scan"
+)
+
+// Stream runs q and yields its rows one at a time, scanned with Scan[T], so that large results are never fully loaded in memory
+// It's the streaming version of bob.All, meant for exports: iteration stops after yielding the first error
+// The underlying rows are closed when the iteration ends, even when the loop breaks early
+// Example usage: for row, err := range bob_helpers.Stream[ExportRow](ctx, exec, psql.Select(query...)) { ... }
+func Stream[T any](ctx context.Context, exec bob.Executor, q bob.Query, opts ...scan.MappingOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		cursor, err := bob.Cursor(ctx, exec, q, Scan[T](opts...))
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer cursor.Close()
+
+		for cursor.Next() {
+			row, err := cursor.Get()
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
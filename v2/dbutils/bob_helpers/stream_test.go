@@ -0,0 +1,47 @@
+package bob_helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+type streamRow struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestStream(t *testing.T) {
+	sqlDB := testutil.OpenSQLite(t, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO users VALUES (1, 'John'), (2, NULL), (3, 'Jane')")
+	exec := bob.NewDB(sqlDB)
+	ctx := context.Background()
+
+	var got []streamRow
+	for row, err := range Stream[streamRow](ctx, exec, psql.RawQuery("SELECT id, name FROM users ORDER BY id")) {
+		require.NoError(t, err)
+		got = append(got, row)
+	}
+	// NULLs are skipped, like with Scan
+	assert.Equal(t, []streamRow{{1, "John"}, {2, ""}, {3, "Jane"}}, got)
+
+	// Breaking early closes the rows, so that the connection can be reused
+	sqlDB.SetMaxOpenConns(1)
+	for range Stream[streamRow](ctx, exec, psql.RawQuery("SELECT id, name FROM users")) {
+		break
+	}
+	var count int
+	require.NoError(t, sqlDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count))
+	assert.Equal(t, 3, count)
+
+	var errs int
+	for _, err := range Stream[streamRow](ctx, exec, psql.RawQuery("SELECT id, name FROM missing")) {
+		assert.Error(t, err)
+		errs++
+	}
+	assert.Equal(t, 1, errs)
+}
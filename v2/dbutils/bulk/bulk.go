@@ -0,0 +1,247 @@
+// Package bulk writes many rows at once, using the bulk copy protocols of lib/pq and go-mssqldb
+// It's kept apart from dbutils so that only the applications using it depend on both drivers
+package bulk
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/top-solution/go-libs/v2/dbutils"
+)
+
+// maxBatchParams bounds the number of parameters of a multi-row statement: MSSQL accepts at most 2100 of them
+const maxBatchParams = 2000
+
+// maxBatchRows bounds the number of rows of a multi-row statement: MSSQL accepts at most 1000 of them in VALUES
+const maxBatchRows = 1000
+
+// Insert inserts rows into table, returning the number of inserted rows
+// Each row holds the values of columns, in the same order
+// It uses COPY on Postgres and bulk copy on MSSQL, falling back to batched multi-row INSERT statements otherwise
+// COPY is only available through lib/pq: other Postgres drivers, such as pgx, get an error wrapping errors.ErrUnsupported
+// Rows are inserted in a single transaction, reusing the one in ctx if any
+func Insert(ctx context.Context, db dbutils.BeginnerExecutor, table string, columns []string, rows iter.Seq[[]any]) (int64, error) {
+	if len(columns) == 0 {
+		return 0, errors.New("bulk insert: no columns")
+	}
+	driver := dbutils.DriverOf(db)
+	if driver == dbutils.PostgresDriver && !isLibPQ(db) {
+		return 0, fmt.Errorf("bulk insert into %s: COPY needs the lib/pq driver: %w", table, errors.ErrUnsupported)
+	}
+
+	count, err := dbutils.TransactionResult(ctx, db, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		switch driver {
+		case dbutils.PostgresDriver:
+			query := pq.CopyIn(table, columns...)
+			if schema, name, ok := strings.Cut(table, "."); ok {
+				query = pq.CopyInSchema(schema, name, columns...)
+			}
+			return copyIn(ctx, tx, query, len(columns), rows)
+		case dbutils.MSSQLDriver:
+			return copyIn(ctx, tx, mssql.CopyIn(driver.Quote(table), mssql.BulkOptions{}, columns...), len(columns), rows)
+		default:
+			prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", driver.Quote(table), quoteAll(driver, columns))
+			return execBatches(ctx, tx, len(columns), rows, func(batch [][]any) string {
+				return prefix + valuesList(driver, len(batch), len(columns))
+			})
+		}
+	})
+	if err != nil {
+		return count, fmt.Errorf("bulk insert into %s: %w", table, err)
+	}
+	return count, nil
+}
+
+// Upsert inserts rows into table, updating the existing ones instead: rows are matched by the keys columns
+// Each row holds the values of columns, in the same order, and columns must include keys
+// It uses INSERT ... ON CONFLICT on Postgres and SQLite, which requires a unique constraint on keys, and MERGE on MSSQL
+// Rows are written in batches, so the same keys must not appear twice in rows
+// Rows are upserted in a single transaction, reusing the one in ctx if any, and the number of processed rows is returned
+func Upsert(ctx context.Context, db dbutils.BeginnerExecutor, table string, columns []string, keys []string, rows iter.Seq[[]any]) (int64, error) {
+	if len(keys) == 0 {
+		return 0, errors.New("upsert: no keys")
+	}
+	var updates []string
+	for _, k := range keys {
+		if !slices.Contains(columns, k) {
+			return 0, fmt.Errorf("upsert: key %s is not one of the columns", k)
+		}
+	}
+	for _, c := range columns {
+		if !slices.Contains(keys, c) {
+			updates = append(updates, c)
+		}
+	}
+	driver := dbutils.DriverOf(db)
+
+	var statement func(batch [][]any) string
+	switch driver {
+	case dbutils.MSSQLDriver:
+		statement = mergeStatement(driver, table, columns, keys, updates)
+	default:
+		statement = onConflictStatement(driver, table, columns, keys, updates)
+	}
+
+	count, err := dbutils.TransactionResult(ctx, db, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		return execBatches(ctx, tx, len(columns), rows, statement)
+	})
+	if err != nil {
+		return count, fmt.Errorf("upsert into %s: %w", table, err)
+	}
+	return count, nil
+}
+
+// onConflictStatement builds the Postgres and SQLite batch upsert statement
+func onConflictStatement(driver dbutils.DriverType, table string, columns, keys, updates []string) func(batch [][]any) string {
+	suffix := " ON CONFLICT (" + quoteAll(driver, keys) + ") DO NOTHING"
+	if len(updates) > 0 {
+		set := make([]string, len(updates))
+		for i, c := range updates {
+			set[i] = driver.Quote(c) + " = EXCLUDED." + driver.Quote(c)
+		}
+		suffix = " ON CONFLICT (" + quoteAll(driver, keys) + ") DO UPDATE SET " + strings.Join(set, ", ")
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", driver.Quote(table), quoteAll(driver, columns))
+
+	return func(batch [][]any) string {
+		return prefix + valuesList(driver, len(batch), len(columns)) + suffix
+	}
+}
+
+// mergeStatement builds the MSSQL batch upsert statement
+func mergeStatement(driver dbutils.DriverType, table string, columns, keys, updates []string) func(batch [][]any) string {
+	on := make([]string, len(keys))
+	for i, k := range keys {
+		on[i] = "target." + driver.Quote(k) + " = source." + driver.Quote(k)
+	}
+	sourceColumns := make([]string, len(columns))
+	for i, c := range columns {
+		sourceColumns[i] = "source." + driver.Quote(c)
+	}
+	var matched string
+	if len(updates) > 0 {
+		set := make([]string, len(updates))
+		for i, c := range updates {
+			set[i] = "target." + driver.Quote(c) + " = source." + driver.Quote(c)
+		}
+		matched = " WHEN MATCHED THEN UPDATE SET " + strings.Join(set, ", ")
+	}
+
+	return func(batch [][]any) string {
+		return fmt.Sprintf("MERGE INTO %s WITH (HOLDLOCK) AS target USING (VALUES %s) AS source (%s) ON %s%s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s);",
+			driver.Quote(table), valuesList(driver, len(batch), len(columns)), quoteAll(driver, columns),
+			strings.Join(on, " AND "), matched, quoteAll(driver, columns), strings.Join(sourceColumns, ", "))
+	}
+}
+
+// isLibPQ reports whether db is a lib/pq connection pool, the only Postgres driver implementing pq.CopyIn
+func isLibPQ(db any) bool {
+	d, ok := db.(interface{ Driver() driver.Driver })
+	if !ok {
+		return false
+	}
+	_, ok = d.Driver().(*pq.Driver)
+	return ok
+}
+
+// copyIn streams rows into a COPY or bulk copy statement, as prepared by pq.CopyIn and mssql.CopyIn
+func copyIn(ctx context.Context, tx *sql.Tx, query string, columns int, rows iter.Seq[[]any]) (int64, error) {
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("prepare copy: %w", err)
+	}
+	defer stmt.Close()
+
+	var count int64
+	for row := range rows {
+		if len(row) != columns {
+			return count, fmt.Errorf("row %d: got %d values, expected %d", count, len(row), columns)
+		}
+		_, err = stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return count, fmt.Errorf("row %d: %w", count, err)
+		}
+		count++
+	}
+	// An Exec without args flushes the buffered rows
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return count, fmt.Errorf("flush copy: %w", err)
+	}
+	return count, nil
+}
+
+// execBatches runs the statement built by statement for each batch of rows, as large as the parameter limits allow
+func execBatches(ctx context.Context, tx *sql.Tx, columns int, rows iter.Seq[[]any], statement func(batch [][]any) string) (int64, error) {
+	batchSize := min(max(maxBatchParams/columns, 1), maxBatchRows)
+	batch := make([][]any, 0, batchSize)
+	args := make([]any, 0, batchSize*columns)
+
+	var count int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		args = args[:0]
+		for _, row := range batch {
+			args = append(args, row...)
+		}
+		_, err := tx.ExecContext(ctx, statement(batch), args...)
+		if err != nil {
+			return fmt.Errorf("rows %d-%d: %w", count, count+int64(len(batch))-1, err)
+		}
+		count += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for row := range rows {
+		if len(row) != columns {
+			return count, fmt.Errorf("row %d: got %d values, expected %d", count+int64(len(batch)), len(row), columns)
+		}
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			err := flush()
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
+
+// valuesList returns the placeholders of a VALUES list of the given size, i.e. ($1, $2), ($3, $4)
+func valuesList(driver dbutils.DriverType, rows, columns int) string {
+	var b strings.Builder
+	for r := range rows {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := range columns {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(driver.Placeholder(r*columns + c + 1))
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// quoteAll quotes and joins identifiers, i.e. a column list
+func quoteAll(driver dbutils.DriverType, identifiers []string) string {
+	quoted := make([]string, len(identifiers))
+	for i, id := range identifiers {
+		quoted[i] = driver.Quote(id)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,109 @@
+package bulk
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/dbutils"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+const itemsTable = "CREATE TABLE items (code TEXT PRIMARY KEY, name TEXT NOT NULL, qty INTEGER NOT NULL)"
+
+func TestInsert(t *testing.T) {
+	sqlDB := testutil.OpenSQLite(t, itemsTable)
+
+	rows := make([][]any, 0, 1500)
+	for i := range 1500 {
+		rows = append(rows, []any{fmt.Sprintf("code-%d", i), "item", i})
+	}
+	count, err := Insert(context.Background(), sqlDB, "items", []string{"code", "name", "qty"}, slices.Values(rows))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1500), count)
+
+	var total int
+	require.NoError(t, sqlDB.QueryRow("SELECT COUNT(*) FROM items").Scan(&total))
+	assert.Equal(t, 1500, total)
+
+	// A failing row rolls back the whole insert
+	_, err = Insert(context.Background(), sqlDB, "items", []string{"code", "name", "qty"}, slices.Values([][]any{{"new", "item", 1}, {"bad"}}))
+	assert.ErrorContains(t, err, "row 1: got 1 values, expected 3")
+	require.NoError(t, sqlDB.QueryRow("SELECT COUNT(*) FROM items").Scan(&total))
+	assert.Equal(t, 1500, total)
+}
+
+func TestInsertUsesContextTx(t *testing.T) {
+	sqlDB := testutil.OpenSQLite(t, itemsTable)
+
+	err := dbutils.Transaction(context.Background(), sqlDB, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := Insert(ctx, sqlDB, "items", []string{"code", "name", "qty"}, slices.Values([][]any{{"a", "item", 1}}))
+		require.NoError(t, err)
+
+		var total int
+		require.NoError(t, tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM items").Scan(&total))
+		assert.Equal(t, 1, total)
+		return sql.ErrNoRows
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	var total int
+	require.NoError(t, sqlDB.QueryRow("SELECT COUNT(*) FROM items").Scan(&total))
+	assert.Equal(t, 0, total)
+}
+
+func TestInsertPostgresNeedsLibPQ(t *testing.T) {
+	pqDB, err := sql.Open("postgres", "postgres://localhost")
+	require.NoError(t, err)
+	defer pqDB.Close()
+	assert.True(t, isLibPQ(pqDB))
+	assert.False(t, isLibPQ(testutil.OpenSQLite(t, itemsTable)))
+}
+
+func TestUpsert(t *testing.T) {
+	sqlDB := testutil.OpenSQLite(t, itemsTable)
+	ctx := context.Background()
+	columns := []string{"code", "name", "qty"}
+
+	_, err := Insert(ctx, sqlDB, "items", columns, slices.Values([][]any{{"a", "first", 1}, {"b", "second", 2}}))
+	require.NoError(t, err)
+
+	count, err := Upsert(ctx, sqlDB, "items", columns, []string{"code"}, slices.Values([][]any{{"b", "updated", 20}, {"c", "third", 3}}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	got := map[string]int{}
+	rows, err := sqlDB.Query("SELECT name, qty FROM items")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var qty int
+		require.NoError(t, rows.Scan(&name, &qty))
+		got[name] = qty
+	}
+	assert.Equal(t, map[string]int{"first": 1, "updated": 20, "third": 3}, got)
+
+	_, err = Upsert(ctx, sqlDB, "items", columns, []string{"id"}, slices.Values([][]any{}))
+	assert.ErrorContains(t, err, "key id is not one of the columns")
+}
+
+func TestUpsertStatements(t *testing.T) {
+	columns := []string{"code", "name"}
+	batch := make([][]any, 2)
+
+	pg := onConflictStatement(dbutils.PostgresDriver, "public.items", columns, []string{"code"}, []string{"name"})
+	assert.Equal(t, `INSERT INTO "public"."items" ("code", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("code") DO UPDATE SET "name" = EXCLUDED."name"`, pg(batch))
+
+	pgNothing := onConflictStatement(dbutils.PostgresDriver, "items", columns, columns, nil)
+	assert.Equal(t, `INSERT INTO "items" ("code", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("code", "name") DO NOTHING`, pgNothing(batch))
+
+	merge := mergeStatement(dbutils.MSSQLDriver, "dbo.items", columns, []string{"code"}, []string{"name"})
+	assert.Equal(t, "MERGE INTO [dbo].[items] WITH (HOLDLOCK) AS target USING (VALUES (@p1, @p2), (@p3, @p4)) AS source ([code], [name]) "+
+		"ON target.[code] = source.[code] WHEN MATCHED THEN UPDATE SET target.[name] = source.[name] "+
+		"WHEN NOT MATCHED THEN INSERT ([code], [name]) VALUES (source.[code], source.[name]);", merge(batch))
+}
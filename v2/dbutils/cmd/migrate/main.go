@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/ardanlabs/conf/v3"
+	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
+	"github.com/top-solution/go-libs/v2/config"
+	"github.com/top-solution/go-libs/v2/dbutils"
+)
+
+const usage = `Usage: migrate [flags] <command> [args]
+
+Commands:
+  up                      apply all pending migrations
+  up-to <version>         apply the pending migrations up to version
+  down                    roll back the latest migration
+  down-to <version>       roll back the migrations down to version
+  redo                    roll back the latest migration and apply it again
+  reset                   roll back all migrations
+  status                  print the state of every migration
+  version                 print the current DB version
+  create <name> [sql|go]  scaffold a new timestamped migration
+
+Go migrations only run from the application binary registering them: up and
+up-to stop before the first pending one, so run the application to apply it`
+
+// Config reads the same DB section used by the apps, so the same conf.yml can be used
+type Config struct {
+	DB   dbutils.DBConfig `yaml:"db"`
+	Args conf.Args        `yaml:"-"`
+}
+
+func main() {
+	var cfg Config
+	err := config.ParseConfigAndVersion(&cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	command := cfg.Args.Num(0)
+	if command == "" {
+		log.Fatal(usage)
+	}
+
+	// Creating a migration doesn't need a DB connection
+	if command == "create" {
+		name := cfg.Args.Num(1)
+		if name == "" {
+			log.Fatal(usage)
+		}
+		migrationType := dbutils.MigrationTypeSQL
+		if t := cfg.Args.Num(2); t != "" {
+			migrationType = dbutils.MigrationType(t)
+		}
+		err = dbutils.CreateMigration(cfg.DB.Migrations.Path, name, migrationType)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Never run the migrations implicitly on Open: the command decides what to do
+	cfg.DB.Migrations.Run = false
+	db, err := dbutils.Open(cfg.DB, os.DirFS("."))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	err = run(context.Background(), db, command, cfg.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, db *dbutils.DB, command string, args conf.Args) error {
+	switch command {
+	case "up":
+		return db.Up()
+	case "up-to":
+		version, err := versionArg(args)
+		if err != nil {
+			return err
+		}
+		return db.UpTo(ctx, version)
+	case "down":
+		return db.Down(ctx)
+	case "down-to":
+		version, err := versionArg(args)
+		if err != nil {
+			return err
+		}
+		return db.DownTo(ctx, version)
+	case "redo":
+		return db.Redo(ctx)
+	case "reset":
+		return db.Reset(ctx)
+	case "status":
+		statuses, err := db.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "-"
+			if s.State == dbutils.MigrationApplied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-8s %-20s %s\n", s.State, appliedAt, s.Source)
+		}
+		return nil
+	case "version":
+		version, err := db.Version()
+		if err != nil {
+			return err
+		}
+		fmt.Println(version)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", command, usage)
+	}
+}
+
+func versionArg(args conf.Args) (int64, error) {
+	version, err := strconv.ParseInt(args.Num(1), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q: %w", args.Num(1), err)
+	}
+	return version, nil
+}
@@ -0,0 +1,35 @@
+// Package dbhuma exposes dbutils features as huma operations
+package dbhuma
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/top-solution/go-libs/v2/dbutils"
+)
+
+// HealthOutput is the response of the operation registered by RegisterHealth
+type HealthOutput struct {
+	Status int
+	Body   dbutils.HealthReport
+}
+
+// RegisterHealth registers a GET operation at path serving db.Health as JSON
+// It answers 503 when the DB is unavailable, so it can be used as a Kubernetes readiness or liveness probe
+func RegisterHealth(api huma.API, path string, db *dbutils.DB) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-db-health",
+		Method:      http.MethodGet,
+		Path:        path,
+		Summary:     "Get DB Health",
+		Tags:        []string{"Health"},
+	}, func(ctx context.Context, _ *struct{}) (*HealthOutput, error) {
+		report := db.Health(ctx)
+		status := http.StatusOK
+		if report.Status != dbutils.HealthOK {
+			status = http.StatusServiceUnavailable
+		}
+		return &HealthOutput{Status: status, Body: report}, nil
+	})
+}
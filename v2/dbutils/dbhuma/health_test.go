@@ -0,0 +1,27 @@
+package dbhuma
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/dbutils"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestRegisterHealth(t *testing.T) {
+	sqlDB, err := sql.Open(testutil.FailingDriverName, "")
+	require.NoError(t, err)
+	db := &dbutils.DB{DB: sqlDB}
+	defer db.Close()
+
+	_, api := humatest.New(t)
+	RegisterHealth(api, "/health/db", db)
+
+	resp := api.Get("/health/db")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"status":"unavailable"`)
+}
@@ -0,0 +1,127 @@
+// Package dbtest helps testing code built on dbutils: it opens a test DB shared by the whole test binary,
+// isolates each test in a transaction rolled back at cleanup, and loads fixtures into it
+//
+// By default it uses an on-disk SQLite database, so tests run offline: set DBTEST_DRIVER and DBTEST_DSN
+// to run the same tests against a real Postgres or MSSQL server
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/top-solution/go-libs/v2/dbutils"
+
+	// Register the drivers dbtest can be configured with
+	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// DriverEnv is the environment variable holding the test DB driver, sqlite by default
+	DriverEnv = "DBTEST_DRIVER"
+	// DSNEnv is the environment variable holding the test DB connection string
+	// It's required for any driver but sqlite, which defaults to a temporary database file
+	DSNEnv = "DBTEST_DSN"
+)
+
+var (
+	shared     *dbutils.DB
+	sharedErr  error
+	sharedOnce sync.Once
+	// tempDir holds the default SQLite database file, removed by Close
+	tempDir string
+)
+
+// Config returns the test DB configuration read from the environment
+func Config() (dbutils.DBConfig, error) {
+	conf := dbutils.DBConfig{
+		Driver: os.Getenv(DriverEnv),
+		DSN:    os.Getenv(DSNEnv),
+	}
+	conf.Migrations.Run = true
+	conf.Migrations.Path = "."
+
+	if conf.Driver == "" {
+		conf.Driver = string(dbutils.SQLiteDriver)
+	}
+	if conf.DSN != "" {
+		return conf, nil
+	}
+	if conf.Driver != string(dbutils.SQLiteDriver) {
+		return conf, fmt.Errorf("%s is required by the %s driver", DSNEnv, conf.Driver)
+	}
+
+	if tempDir == "" {
+		dir, err := os.MkdirTemp("", "dbtest")
+		if err != nil {
+			return conf, fmt.Errorf("create sqlite temp dir: %w", err)
+		}
+		tempDir = dir
+	}
+	// Transactions take the write lock right away and wait for each other, so that parallel tests just queue up
+	conf.DSN = "file:" + filepath.Join(tempDir, "dbtest.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(30000)&_txlock=immediate"
+	return conf, nil
+}
+
+// Open returns the shared test DB, opening it and running the migrations found in fsys on first use
+// Migrations run once per test binary, so every call is expected to pass the same fsys: pass nil to skip them
+func Open(t testing.TB, fsys fs.FS) *dbutils.DB {
+	t.Helper()
+
+	sharedOnce.Do(func() {
+		conf, err := Config()
+		if err != nil {
+			sharedErr = err
+			return
+		}
+		// Fail fast: there's no point in waiting for a test DB which isn't there
+		shared, sharedErr = dbutils.OpenContext(context.Background(), conf, fsys, dbutils.WithRetryPolicy(dbutils.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: 500 * time.Millisecond,
+		}))
+	})
+	if sharedErr != nil {
+		t.Fatalf("open test db: %s", sharedErr)
+	}
+	return shared
+}
+
+// Context returns a context carrying a transaction on db, which is rolled back when the test ends
+// Code using dbutils.Transaction or dbutils.TxOr with it runs inside that transaction, so nothing reaches the DB
+func Context(t testing.TB, db dbutils.BeginnerExecutor) context.Context {
+	t.Helper()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin test transaction: %s", err)
+	}
+	t.Cleanup(func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			t.Errorf("rollback test transaction: %s", err)
+		}
+	})
+	return dbutils.WithTx(t.Context(), tx)
+}
+
+// Close closes the shared test DB, removing the temporary SQLite database if any
+// It's meant to be called from TestMain, after m.Run()
+func Close() error {
+	var errs []error
+	if shared != nil {
+		errs = append(errs, shared.Close())
+	}
+	if tempDir != "" {
+		errs = append(errs, os.RemoveAll(tempDir))
+	}
+	return errors.Join(errs...)
+}
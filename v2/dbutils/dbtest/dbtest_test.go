@@ -0,0 +1,103 @@
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/dbutils"
+)
+
+var migrations = fstest.MapFS{
+	"00001_init.sql": &fstest.MapFile{Data: []byte(`-- +goose Up
+CREATE TABLE owners (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+CREATE TABLE pets (id INTEGER PRIMARY KEY, owner_id INTEGER NOT NULL REFERENCES owners (id), tags TEXT);
+`)},
+}
+
+var fixtures = fstest.MapFS{
+	"owners.yaml": &fstest.MapFile{Data: []byte(`owners:
+  - id: 1
+    name: John
+  - id: 2
+    name: Jane
+pets:
+  - id: 1
+    owner_id: 2
+    tags: [dog, brown]
+`)},
+	"pets.json": &fstest.MapFile{Data: []byte(`{"pets": [{"id": 2, "owner_id": 1, "tags": null}]}`)},
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	_ = Close()
+	os.Exit(code)
+}
+
+func countRows(t *testing.T, ctx context.Context, db *dbutils.DB, table string) int {
+	var count int
+	err := dbutils.TxOr(ctx, db).QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count)
+	require.NoError(t, err)
+	return count
+}
+
+func TestContextIsolation(t *testing.T) {
+	db := Open(t, migrations)
+	assert.Same(t, db, Open(t, migrations))
+
+	t.Run("load fixtures", func(t *testing.T) {
+		ctx := Context(t, db)
+		MustLoadFixtures(t, ctx, db, fixtures, "owners.yaml", "pets.json")
+
+		assert.Equal(t, 2, countRows(t, ctx, db, "owners"))
+		assert.Equal(t, 2, countRows(t, ctx, db, "pets"))
+
+		var tags sql.NullString
+		err := dbutils.Tx(ctx).QueryRowContext(ctx, "SELECT tags FROM pets WHERE id = 1").Scan(&tags)
+		require.NoError(t, err)
+		assert.Equal(t, `["dog","brown"]`, tags.String)
+
+		// Transaction reuses the test transaction instead of committing
+		err = dbutils.Transaction(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO owners (id, name) VALUES (3, 'Jim')")
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, countRows(t, ctx, db, "owners"))
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		ctx := Context(t, db)
+		assert.Equal(t, 0, countRows(t, ctx, db, "owners"))
+	})
+}
+
+func TestLoadFixturesErrors(t *testing.T) {
+	db := Open(t, migrations)
+	ctx := Context(t, db)
+
+	err := LoadFixtures(ctx, db, fstest.MapFS{"bad.yaml": &fstest.MapFile{Data: []byte("owners: 1")}}, "bad.yaml")
+	assert.ErrorContains(t, err, "must be a list of rows")
+
+	err = LoadFixtures(ctx, db, fstest.MapFS{"bad.yaml": &fstest.MapFile{Data: []byte("pets:\n  - id: 1\n    owner_id: 42")}}, "bad.yaml")
+	assert.ErrorContains(t, err, "insert row 0 into pets")
+
+	err = LoadFixtures(ctx, db, fixtures, "missing.yaml")
+	assert.Error(t, err)
+}
+
+func TestInsertQuery(t *testing.T) {
+	query, args, err := insertQuery(dbutils.PostgresDriver, "public.pets", map[string]any{"owner_id": 1, "id": 2})
+	require.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "public"."pets" ("id", "owner_id") VALUES ($1, $2)`, query)
+	assert.Equal(t, []any{2, 1}, args)
+
+	query, _, err = insertQuery(dbutils.MSSQLDriver, "pets", map[string]any{"id": 2})
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO [pets] ([id]) VALUES (@p1)", query)
+}
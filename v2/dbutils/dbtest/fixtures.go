@@ -0,0 +1,104 @@
+package dbtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/top-solution/go-libs/v2/dbutils"
+)
+
+// LoadFixtures inserts the rows described by the given YAML or JSON files of fsys, using the transaction in ctx if any
+// Each file maps table names to lists of rows, and each row maps column names to values:
+//
+//	owners:
+//	  - id: 1
+//	    name: John
+//	pets:
+//	  - id: 1
+//	    owner_id: 1
+//	    tags: [dog, brown]
+//
+// Tables are filled in the order they appear, so that foreign keys can be satisfied
+// Maps and lists are stored as JSON, i.e. for jsonb columns
+func LoadFixtures(ctx context.Context, db *dbutils.DB, fsys fs.FS, paths ...string) error {
+	exec := dbutils.TxOr(ctx, db)
+	driver := db.DriverType()
+
+	for _, p := range paths {
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("read fixtures: %w", err)
+		}
+		// YAML is a superset of JSON, so a single parser covers both
+		var tables yaml.MapSlice
+		err = yaml.Unmarshal(data, &tables)
+		if err != nil {
+			return fmt.Errorf("parse fixtures %s: %w", p, err)
+		}
+
+		for _, table := range tables {
+			name := fmt.Sprint(table.Key)
+			rows, ok := table.Value.([]any)
+			if !ok {
+				return fmt.Errorf("fixtures %s: table %s must be a list of rows", p, name)
+			}
+			for i, r := range rows {
+				row, ok := r.(map[string]any)
+				if !ok {
+					return fmt.Errorf("fixtures %s: row %d of table %s must map columns to values", p, i, name)
+				}
+				query, args, err := insertQuery(driver, name, row)
+				if err != nil {
+					return fmt.Errorf("fixtures %s: row %d of table %s: %w", p, i, name, err)
+				}
+				_, err = exec.ExecContext(ctx, query, args...)
+				if err != nil {
+					return fmt.Errorf("fixtures %s: insert row %d into %s: %w", p, i, name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// MustLoadFixtures is like LoadFixtures, but fails the test on error
+func MustLoadFixtures(t testing.TB, ctx context.Context, db *dbutils.DB, fsys fs.FS, paths ...string) {
+	t.Helper()
+
+	err := LoadFixtures(ctx, db, fsys, paths...)
+	if err != nil {
+		t.Fatalf("load fixtures: %s", err)
+	}
+}
+
+// insertQuery builds the statement inserting row into table, with the columns sorted by name
+func insertQuery(driver dbutils.DriverType, table string, row map[string]any) (string, []any, error) {
+	columns := slices.Sorted(maps.Keys(row))
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, c := range columns {
+		quoted[i] = driver.Quote(c)
+		placeholders[i] = driver.Placeholder(i + 1)
+		args[i] = row[c]
+		switch row[c].(type) {
+		case map[string]any, []any:
+			value, err := json.Marshal(row[c])
+			if err != nil {
+				return "", nil, fmt.Errorf("column %s: %w", c, err)
+			}
+			args[i] = string(value)
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		driver.Quote(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+	return query, args, nil
+}
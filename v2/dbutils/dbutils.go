@@ -8,6 +8,7 @@ import (
 	"io/fs"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pressly/goose/v3"
@@ -18,15 +19,41 @@ type DriverType string
 const (
 	MSSQLDriver    DriverType = "sqlserver"
 	PostgresDriver DriverType = "postgres"
+	// SQLiteDriver is meant for tests and tools: it needs the modernc.org/sqlite driver to be imported
+	SQLiteDriver DriverType = "sqlite"
 )
 
 var CurrentDriver = PostgresDriver
 
+// Placeholder returns the n-th (1-based) query parameter placeholder in the driver syntax
+func (d DriverType) Placeholder(n int) string {
+	switch d {
+	case MSSQLDriver:
+		return fmt.Sprintf("@p%d", n)
+	case SQLiteDriver:
+		return "?"
+	default:
+		return fmt.Sprintf("$%d", n)
+	}
+}
+
+// Quote quotes an identifier, i.e. a table or column name, in the driver syntax
+// Dots are treated as separators, so that schema.table is quoted as two identifiers
+func (d DriverType) Quote(identifier string) string {
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		if d == MSSQLDriver {
+			parts[i] = "[" + strings.ReplaceAll(part, "]", "]]") + "]"
+			continue
+		}
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
 // TxKey holds a transaction in a ctx
 var TxKey txctx = "transaction"
 
-var connectionRetries = []time.Duration{1, 1, 2, 2, 3, 5, 8}
-
 type txctx string
 
 // Beginner begins transactions.
@@ -73,11 +100,48 @@ type DBConfig struct {
 	Migrations struct {
 		Run  bool   `yaml:"run" conf:"default:false,help:If true, migrations will be run on app startup"`
 		Path string `yaml:"path" conf:"default:sql,help:The path to the directory containing the Goose-compatible SQL migrations"`
+		// LockTimeout is how long to wait for other instances to finish migrating:
+		// 0 means DefaultMigrationsLockTimeout, a negative value waits forever
+		LockTimeout time.Duration `yaml:"lockTimeout" conf:"default:5m,help:How long to wait for the cluster-wide migrations lock (negative waits forever)"`
+		// TenantPath is the directory containing the migrations run in every tenant schema by MigrateTenants and CreateTenant
+		TenantPath string `yaml:"tenantPath" conf:"help:The path to the directory containing the migrations of the tenant schemas"`
 	} `yaml:"migrations"`
 	// If connecting to an instance instead of a port
 	Instance string `yaml:"instance" conf:"help:The db instance"`
 	// Schema is the db schema
 	Schema string `yaml:"schema" conf:"help:The db schema"`
+	// Pool tunes the connection pool: zero values keep the database/sql defaults
+	Pool struct {
+		MaxOpenConns    int           `yaml:"maxOpenConns" conf:"help:The max number of open connections (0 means unlimited)"`
+		MaxIdleConns    int           `yaml:"maxIdleConns" conf:"help:The max number of idle connections (0 keeps the default and a negative value disables them)"`
+		ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" conf:"help:The max amount of time a connection may be reused (0 means forever)"`
+		ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime" conf:"help:The max amount of time a connection may be idle (0 means forever)"`
+	} `yaml:"pool"`
+	// StatementTimeout aborts any statement taking longer than it (Postgres only)
+	StatementTimeout time.Duration `yaml:"statementTimeout" conf:"help:Abort statements taking longer than this (Postgres only)"`
+	// ApplicationName is reported to the db server, to tell connections apart
+	ApplicationName string `yaml:"applicationName" conf:"help:The application name reported to the db server"`
+	// SSL configures the connection encryption
+	SSL struct {
+		// Mode is one of disable, require, verify-ca, verify-full (defaults to disable)
+		Mode string `yaml:"mode" conf:"help:The SSL mode: one of disable/require/verify-ca/verify-full"`
+		// RootCert is the path of the CA certificate used to verify the server
+		RootCert string `yaml:"rootCert" conf:"help:The path of the CA certificate used to verify the server"`
+		// Cert and Key are the paths of the client certificate and key (Postgres only)
+		Cert string `yaml:"cert" conf:"help:The path of the client certificate (Postgres only)"`
+		Key  string `yaml:"key" conf:"help:The path of the client certificate key (Postgres only)"`
+	} `yaml:"ssl"`
+	// Params are extra connection string parameters, which override the ones computed from the other fields
+	Params map[string]string `yaml:"params" conf:"help:Extra connection string parameters in the key:value;key:value format"`
+	// DSN is a raw connection string: when set, it's used as-is instead of building one from the other fields
+	DSN string `yaml:"dsn" conf:"noprint,help:A raw connection string overriding all the other connection settings"`
+	// Replicas are the read replicas used by DB.Reader(): they share every other setting with the primary
+	Replicas struct {
+		// Hosts are the replica addresses, in the host or host:port format
+		Hosts []string `yaml:"hosts" conf:"help:The read replica addresses in the host:port format separated by ;"`
+		// HealthCheckInterval is how often unhealthy replicas are excluded (and healthy ones included back)
+		HealthCheckInterval time.Duration `yaml:"healthCheckInterval" conf:"default:10s,help:How often the read replicas are health-checked"`
+	} `yaml:"replicas"`
 }
 
 // Transaction either embeds the transaction in the given context or uses an existing one from the context
@@ -119,6 +183,11 @@ func TransactionResult[T any](ctx context.Context, db BeginnerExecutor, txFunc f
 			err = tx.Commit() // err is nil; if Commit returns an error, update err
 		}
 	}()
+
+	err = runTxHooks(ctx, tx, DriverOf(db))
+	if err != nil {
+		return
+	}
 	return txFunc(ctx, tx)
 }
 
@@ -150,14 +219,37 @@ type DB struct {
 	*sql.DB
 	conf DBConfig
 	fsys fs.FS
+
+	// provider is the goose migrations provider, built lazily from fsys
+	provider   *goose.Provider
+	providerMu sync.Mutex
+	// hiddenMigrations are the versions of the Go migration files the provider can't run, see hiddenGoMigrations
+	hiddenMigrations []int64
+
+	// replicas are the read replicas used by Reader, nil if none is configured
+	replicas *replicaSet
+
+	// goMigrations are the Go migrations set by WithGoMigrations, merged with the SQL ones
+	goMigrations []GoMigration
+}
+
+// DriverType returns the type of the configured driver
+func (d *DB) DriverType() DriverType {
+	return normalizeDriver(d.conf.Driver)
 }
 
 // Open opens a database connection given a config struct
 // It expects a fs.FS in order to fetch and run the DB migrations
 // If you don't need them, just pass nil instead
 func Open(conf DBConfig, fsys fs.FS) (db *DB, err error) {
+	return OpenContext(context.Background(), conf, fsys)
+}
+
+// OpenContext is like Open, but waiting for the DB server can be cancelled via ctx,
+// and the retry policy and logger can be customized via opts
+func OpenContext(ctx context.Context, conf DBConfig, fsys fs.FS, opts ...OpenOption) (db *DB, err error) {
 	if conf.Driver == "" {
-		return nil, errors.New("no SQL driver specified: please use one of [mssql,postgres]")
+		return nil, errors.New("no SQL driver specified: please use one of [mssql,postgres,sqlite]")
 	}
 
 	connectionString := fromDBConfToConnectionString(conf)
@@ -166,66 +258,55 @@ func Open(conf DBConfig, fsys fs.FS) (db *DB, err error) {
 		return nil, errors.New("unsupported driver: " + conf.Driver)
 	}
 
-	var sqlDB *sql.DB
+	options := newOpenOptions(opts...)
+	err = validateGoMigrations(options.goMigrations)
+	if err != nil {
+		return nil, err
+	}
 
 	// Make sure the DB is actually reachable
-	for _, delay := range connectionRetries {
-		sqlDB, err = sql.Open(conf.Driver, connectionString)
-		if err == nil {
-			err = sqlDB.Ping()
-			if err == nil {
-				break
-			}
-		}
-		time.Sleep(delay * time.Second)
-	}
+	sqlDB, err := connect(ctx, conf.Driver, connectionString, options)
 	if err != nil {
 		return nil, fmt.Errorf("reaching DB server: %w", err)
 	}
+	configurePool(sqlDB, conf)
 
-	db = &DB{DB: sqlDB, conf: conf, fsys: fsys}
+	db = &DB{DB: sqlDB, conf: conf, fsys: fsys, goMigrations: options.goMigrations}
 	// DB should be ready, run migrations if needed
 	if conf.Migrations.Run {
 		if fsys != nil {
-			err = db.Migrate(fsys)
+			err = db.migrate(ctx, fsys)
 			if err != nil {
+				sqlDB.Close()
 				return nil, fmt.Errorf("cannote run db migrations: %w", err)
 			}
 		}
 	}
 
+	if len(conf.Replicas.Hosts) > 0 {
+		db.replicas, err = openReplicas(ctx, conf, options)
+		if err != nil {
+			sqlDB.Close()
+			return nil, fmt.Errorf("opening read replicas: %w", err)
+		}
+	}
+
 	return db, nil
 }
 
+// Migrate runs the migrations found in fsys, if enabled by the configuration
+// The migrations are run while holding a cluster-wide lock, so that multiple instances starting at once don't race
 func (d *DB) Migrate(fsys fs.FS) (err error) {
+	return d.migrate(context.Background(), fsys)
+}
+
+func (d *DB) migrate(ctx context.Context, fsys fs.FS) error {
 	if !d.conf.Migrations.Run {
 		return nil
 	}
-	// Init Goose
-	err = goose.SetDialect(d.conf.Driver)
-	if err != nil {
-		return fmt.Errorf("set migrations dialect: %w", err)
-	}
-	d.fsys = fsys
-	goose.SetBaseFS(d.fsys)
-
-	tableName := goose.DefaultTablename
-
-	// Specify schema when hinted by the configuration
-	if d.conf.Schema != "" {
-		schema, _, _ := strings.Cut(d.conf.Schema, ",")
-		tableName = schema + "." + tableName
-	}
-
-	goose.SetTableName(tableName)
-
-	// Goose wants to use the "sqlserver" driver, never "mssql"
-	driver := d.conf.Driver
-	if driver == "mssql" {
-		driver = "sqlserver"
-	}
+	d.setFS(fsys)
 
-	err = goose.Up(d.DB, d.conf.Migrations.Path)
+	err := d.up(ctx)
 	if err != nil {
 		return fmt.Errorf("migrate db: %w", err)
 	}
@@ -247,19 +328,56 @@ func fromDBConfToConnectionString(conf DBConfig) string {
 
 	switch conf.Driver {
 	case string(MSSQLDriver):
-		query.Add("database", conf.DB)
 		CurrentDriver = MSSQLDriver
+		if conf.DSN != "" {
+			return conf.DSN
+		}
+		query.Add("database", conf.DB)
+		if conf.ApplicationName != "" {
+			query.Add("app name", conf.ApplicationName)
+		}
+		addMSSQLSSLParams(query, conf)
 	case string(PostgresDriver):
+		CurrentDriver = PostgresDriver
+		if conf.DSN != "" {
+			return conf.DSN
+		}
 		query.Add("dbname", conf.DB)
-		query.Add("sslmode", "disable")
+		addPostgresSSLParams(query, conf)
+		if conf.ApplicationName != "" {
+			query.Add("application_name", conf.ApplicationName)
+		}
+		var options []string
 		if conf.Schema != "" {
-			query.Add("options", "-c search_path="+conf.Schema)
+			options = append(options, "-c search_path="+conf.Schema)
 		}
-		CurrentDriver = PostgresDriver
+		if conf.StatementTimeout > 0 {
+			options = append(options, fmt.Sprintf("-c statement_timeout=%d", conf.StatementTimeout.Milliseconds()))
+		}
+		if len(options) > 0 {
+			query.Add("options", strings.Join(options, " "))
+		}
+	case string(SQLiteDriver):
+		CurrentDriver = SQLiteDriver
+		if conf.DSN != "" {
+			return conf.DSN
+		}
+		// SQLite has no server: DB is the path of the database file
+		for k, v := range conf.Params {
+			query.Set(k, v)
+		}
+		if len(query) == 0 {
+			return conf.DB
+		}
+		return conf.DB + "?" + query.Encode()
 	default:
 		return ""
 	}
 
+	for k, v := range conf.Params {
+		query.Set(k, v)
+	}
+
 	if conf.User != "" {
 		u.User = url.UserPassword(conf.User, conf.Password)
 	}
@@ -274,13 +392,63 @@ func fromDBConfToConnectionString(conf DBConfig) string {
 	return connectionString
 }
 
-// Up runs the migrations up to the latest version
-func (d *DB) Up() error {
-	if d.fsys == nil {
-		return errors.New("can't run migrations: no file system was passed to Open()")
+// addPostgresSSLParams maps the SSL config to lib/pq parameters
+func addPostgresSSLParams(query url.Values, conf DBConfig) {
+	mode := conf.SSL.Mode
+	if mode == "" {
+		mode = "disable"
+	}
+	query.Add("sslmode", mode)
+	if conf.SSL.RootCert != "" {
+		query.Add("sslrootcert", conf.SSL.RootCert)
 	}
+	if conf.SSL.Cert != "" {
+		query.Add("sslcert", conf.SSL.Cert)
+	}
+	if conf.SSL.Key != "" {
+		query.Add("sslkey", conf.SSL.Key)
+	}
+}
+
+// addMSSQLSSLParams maps the SSL config to go-mssqldb parameters
+// When no mode is configured, the driver defaults are kept
+func addMSSQLSSLParams(query url.Values, conf DBConfig) {
+	switch conf.SSL.Mode {
+	case "":
+	case "disable":
+		query.Add("encrypt", "disable")
+	case "require":
+		// Encrypt, but don't verify the server certificate, like Postgres does
+		query.Add("encrypt", "true")
+		query.Add("TrustServerCertificate", "true")
+	default:
+		query.Add("encrypt", "true")
+		query.Add("TrustServerCertificate", "false")
+	}
+	if conf.SSL.RootCert != "" {
+		query.Add("certificate", conf.SSL.RootCert)
+	}
+}
+
+// configurePool applies the pool configuration, leaving the database/sql defaults for zero values
+func configurePool(sqlDB *sql.DB, conf DBConfig) {
+	if conf.Pool.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(conf.Pool.MaxOpenConns)
+	}
+	if conf.Pool.MaxIdleConns != 0 {
+		sqlDB.SetMaxIdleConns(conf.Pool.MaxIdleConns)
+	}
+	if conf.Pool.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(conf.Pool.ConnMaxLifetime)
+	}
+	if conf.Pool.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(conf.Pool.ConnMaxIdleTime)
+	}
+}
 
-	err := goose.Up(d.DB, d.conf.Migrations.Path)
+// Up runs the migrations up to the latest version
+func (d *DB) Up() error {
+	err := d.up(context.Background())
 	if err != nil {
 		return fmt.Errorf("running db migrations: %w", err)
 	}
@@ -292,5 +460,9 @@ func (d *DB) Version() (int64, error) {
 	if d.fsys == nil {
 		return -1, nil
 	}
-	return goose.GetDBVersion(d.DB)
+	provider, err := d.migrationsProvider()
+	if err != nil {
+		return -1, err
+	}
+	return provider.GetDBVersion(context.Background())
 }
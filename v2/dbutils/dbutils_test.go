@@ -2,6 +2,7 @@ package dbutils
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -86,6 +87,100 @@ func TestConnectionString(t *testing.T) {
 			},
 			expectedString: "sqlserver://MSSQL%5C%2FSERVER/INS%3FTANCE?database=databa_%3B%3Asename",
 		},
+
+		{
+			name: "postgres with options",
+			conf: func() DBConfig {
+				conf := DBConfig{
+					Driver:           "postgres",
+					Server:           "localhost",
+					DB:               "databasename",
+					Schema:           "myschema",
+					StatementTimeout: 5 * time.Second,
+					ApplicationName:  "myapp",
+					Params:           map[string]string{"connect_timeout": "10"},
+				}
+				conf.SSL.Mode = "verify-full"
+				conf.SSL.RootCert = "/certs/ca.pem"
+				conf.SSL.Cert = "/certs/client.pem"
+				conf.SSL.Key = "/certs/client.key"
+				return conf
+			}(),
+			expectedString: "postgres://localhost?application_name=myapp&connect_timeout=10&dbname=databasename&options=-c+search_path%3Dmyschema+-c+statement_timeout%3D5000&sslcert=%2Fcerts%2Fclient.pem&sslkey=%2Fcerts%2Fclient.key&sslmode=verify-full&sslrootcert=%2Fcerts%2Fca.pem",
+		},
+
+		{
+			name: "postgres with params overriding computed ones",
+			conf: DBConfig{
+				Driver: "postgres",
+				Server: "localhost",
+				DB:     "databasename",
+				Params: map[string]string{"sslmode": "require"},
+			},
+			expectedString: "postgres://localhost?dbname=databasename&sslmode=require",
+		},
+
+		{
+			name: "postgres with raw dsn",
+			conf: DBConfig{
+				Driver: "postgres",
+				Server: "ignored",
+				DSN:    "host=localhost dbname=databasename",
+			},
+			expectedString: "host=localhost dbname=databasename",
+		},
+
+		{
+			name: "mssql with options",
+			conf: func() DBConfig {
+				conf := DBConfig{
+					Driver:          "sqlserver",
+					Server:          "localhost",
+					DB:              "databasename",
+					ApplicationName: "myapp",
+				}
+				conf.SSL.Mode = "require"
+				conf.SSL.RootCert = "/certs/ca.pem"
+				return conf
+			}(),
+			expectedString: "sqlserver://localhost?TrustServerCertificate=true&app+name=myapp&certificate=%2Fcerts%2Fca.pem&database=databasename&encrypt=true",
+		},
+
+		{
+			name: "sqlite",
+			conf: DBConfig{
+				Driver: "sqlite",
+				DB:     "/tmp/test.db",
+				Params: map[string]string{"_pragma": "foreign_keys(1)"},
+			},
+			expectedString: "/tmp/test.db?_pragma=foreign_keys%281%29",
+		},
+		{
+			name: "sqlite without params",
+			conf: DBConfig{
+				Driver: "sqlite",
+				DB:     "/tmp/test.db",
+			},
+			expectedString: "/tmp/test.db",
+		},
+		{
+			name: "sqlite dsn",
+			conf: DBConfig{
+				Driver: "sqlite",
+				DB:     "/tmp/ignored.db",
+				DSN:    "file::memory:?cache=shared",
+			},
+			expectedString: "file::memory:?cache=shared",
+		},
+
+		{
+			name: "unsupported driver",
+			conf: DBConfig{
+				Driver: "mysql",
+				DSN:    "user@/dbname",
+			},
+			expectedString: "",
+		},
 	}
 
 	for _, tc := range cases {
@@ -95,3 +190,25 @@ func TestConnectionString(t *testing.T) {
 		})
 	}
 }
+
+func TestDriverTypeSyntax(t *testing.T) {
+	assert.Equal(t, "$2", PostgresDriver.Placeholder(2))
+	assert.Equal(t, "@p2", MSSQLDriver.Placeholder(2))
+	assert.Equal(t, "?", SQLiteDriver.Placeholder(2))
+
+	assert.Equal(t, `"public"."my""table"`, PostgresDriver.Quote(`public.my"table`))
+	assert.Equal(t, "[dbo].[my]]table]", MSSQLDriver.Quote("dbo.my]table"))
+	assert.Equal(t, `"users"`, SQLiteDriver.Quote("users"))
+}
+
+func TestDBDriverType(t *testing.T) {
+	for driver, expected := range map[string]DriverType{
+		"postgres":  PostgresDriver,
+		"sqlserver": MSSQLDriver,
+		"mssql":     MSSQLDriver,
+		"sqlite":    SQLiteDriver,
+	} {
+		db := &DB{conf: DBConfig{Driver: driver}}
+		assert.Equal(t, expected, db.DriverType(), driver)
+	}
+}
@@ -0,0 +1,168 @@
+package dbutils
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/pressly/goose/v3"
+)
+
+// TxMigrationFunc is a Go migration step run inside a transaction
+type TxMigrationFunc func(ctx context.Context, tx *sql.Tx) error
+
+// DBMigrationFunc is a Go migration step run outside of a transaction, for statements which can't run in one
+type DBMigrationFunc func(ctx context.Context, db *sql.DB) error
+
+// GoMigration is a migration written in Go, run alongside the SQL ones in version order
+// For each direction, set either the Tx or the DB variant: leaving both nil just records the version
+type GoMigration struct {
+	Version int64
+	UpTx    TxMigrationFunc
+	UpDB    DBMigrationFunc
+	DownTx  TxMigrationFunc
+	DownDB  DBMigrationFunc
+}
+
+// WithGoMigrations sets the Go migrations of the DB, merged with the SQL ones of the migrations path
+// They're not run in the tenant schemas, whose migrations are SQL only
+func WithGoMigrations(migrations ...GoMigration) OpenOption {
+	return func(o *openOptions) {
+		o.goMigrations = append(o.goMigrations, migrations...)
+	}
+}
+
+// validateGoMigrations checks the Go migrations passed to WithGoMigrations
+func validateGoMigrations(migrations []GoMigration) error {
+	versions := map[int64]bool{}
+	for _, m := range migrations {
+		if m.Version < 1 {
+			return fmt.Errorf("go migration: invalid version %d", m.Version)
+		}
+		if m.UpTx != nil && m.UpDB != nil {
+			return fmt.Errorf("go migration %d: only one of UpTx and UpDB can be set", m.Version)
+		}
+		if m.DownTx != nil && m.DownDB != nil {
+			return fmt.Errorf("go migration %d: only one of DownTx and DownDB can be set", m.Version)
+		}
+		if versions[m.Version] {
+			return fmt.Errorf("go migration %d: version already registered", m.Version)
+		}
+		versions[m.Version] = true
+	}
+	return nil
+}
+
+// gooseGoMigrations returns migrations as goose migrations, sorted by version
+func gooseGoMigrations(migrations []GoMigration) []*goose.Migration {
+	result := make([]*goose.Migration, 0, len(migrations))
+	for _, m := range migrations {
+		result = append(result, goose.NewGoMigration(m.Version,
+			&goose.GoFunc{RunTx: m.UpTx, RunDB: m.UpDB},
+			&goose.GoFunc{RunTx: m.DownTx, RunDB: m.DownDB},
+		))
+	}
+	slices.SortFunc(result, func(a, b *goose.Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return result
+}
+
+// checkGoMigrationConflicts makes sure no Go migration shares its version with a SQL migration file,
+// and that no two migration files, either SQL or Go, share a version: goose never sees the Go files, see sqlMigrationsFS
+func checkGoMigrationConflicts(migrationsFS fs.FS, migrations []*goose.Migration) error {
+	var errs []error
+	fileVersions := map[int64]string{}
+	for _, pattern := range []string{"*.sql", "*.go"} {
+		files, err := fs.Glob(migrationsFS, pattern)
+		if err != nil {
+			return fmt.Errorf("list migrations: %w", err)
+		}
+		for _, f := range files {
+			if strings.HasSuffix(f, "_test.go") {
+				continue
+			}
+			version, err := goose.NumericComponent(f)
+			if err != nil {
+				// Not a migration file: goose will ignore it as well
+				continue
+			}
+			if existing, ok := fileVersions[version]; ok {
+				errs = append(errs, fmt.Errorf("migration %s conflicts with migration %s", path.Base(f), path.Base(existing)))
+				continue
+			}
+			fileVersions[version] = f
+		}
+	}
+
+	for _, m := range migrations {
+		if f, ok := fileVersions[m.Version]; ok && path.Ext(f) == ".sql" {
+			errs = append(errs, fmt.Errorf("go migration %d conflicts with sql migration %s", m.Version, path.Base(f)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hiddenGoMigrations returns the sorted versions of the Go migration files not registered with WithGoMigrations:
+// goose never sees them, see sqlMigrationsFS, so they can't be run by this binary
+func hiddenGoMigrations(migrationsFS fs.FS, migrations []*goose.Migration) ([]int64, error) {
+	files, err := fs.Glob(migrationsFS, "*.go")
+	if err != nil {
+		return nil, fmt.Errorf("list migrations: %w", err)
+	}
+	var hidden []int64
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		version, err := goose.NumericComponent(f)
+		if err != nil {
+			continue
+		}
+		registered := slices.ContainsFunc(migrations, func(m *goose.Migration) bool { return m.Version == version })
+		if !registered {
+			hidden = append(hidden, version)
+		}
+	}
+	slices.Sort(hidden)
+	return hidden, nil
+}
+
+// goMigrationTemplate is the template used by CreateMigration for Go migrations
+var goMigrationTemplate = template.Must(template.New("dbutils.go-migration").Parse(`package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/top-solution/go-libs/v2/dbutils"
+)
+
+// Migrations is expected to be declared once in the package, and passed to dbutils.WithGoMigrations:
+//
+//	var Migrations []dbutils.GoMigration
+func init() {
+	Migrations = append(Migrations, dbutils.GoMigration{
+		Version: {{.Version}},
+		UpTx:    up{{.CamelName}},
+		DownTx:  down{{.CamelName}},
+	})
+}
+
+func up{{.CamelName}}(ctx context.Context, tx *sql.Tx) error {
+	// This code is executed when the migration is applied.
+	return nil
+}
+
+func down{{.CamelName}}(ctx context.Context, tx *sql.Tx) error {
+	// This code is executed when the migration is rolled back.
+	return nil
+}
+`))
@@ -0,0 +1,104 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestValidateGoMigrations(t *testing.T) {
+	noop := func(ctx context.Context, tx *sql.Tx) error { return nil }
+	assert.NoError(t, validateGoMigrations([]GoMigration{{Version: 3, UpTx: noop, DownTx: noop}, {Version: 4}}))
+
+	assert.Error(t, validateGoMigrations([]GoMigration{{Version: 3, UpTx: noop}, {Version: 3}}), "duplicate version")
+	assert.Error(t, validateGoMigrations([]GoMigration{{Version: 0, UpTx: noop}}), "invalid version")
+	assert.Error(t, validateGoMigrations([]GoMigration{{
+		Version: 4,
+		UpTx:    noop,
+		UpDB:    func(ctx context.Context, db *sql.DB) error { return nil },
+	}}), "both up functions")
+}
+
+func TestGoMigrationsMergedWithSQL(t *testing.T) {
+	sqlDB, err := sql.Open("postgres", "postgres://localhost")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := &DB{DB: sqlDB, conf: DBConfig{Driver: "postgres"}, goMigrations: []GoMigration{{Version: 2}}}
+	db.conf.Migrations.Path = "sql"
+	db.setFS(fstest.MapFS{
+		"sql/00001_first.sql": &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+		"sql/00003_third.sql": &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+	})
+	provider, err := db.migrationsProvider()
+	require.NoError(t, err)
+
+	sources := provider.ListSources()
+	require.Len(t, sources, 3)
+	assert.Equal(t, int64(2), sources[1].Version)
+
+	// A SQL file with the same version of a Go migration is rejected
+	db.setFS(fstest.MapFS{
+		"sql/00002_conflict.sql": &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+	})
+	_, err = db.migrationsProvider()
+	assert.ErrorContains(t, err, "conflicts with sql migration 00002_conflict.sql")
+
+	// Go migrations belong to their DB only
+	other := &DB{DB: sqlDB, conf: DBConfig{Driver: "postgres"}}
+	other.conf.Migrations.Path = "sql"
+	other.setFS(fstest.MapFS{
+		"sql/00002_conflict.sql": &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+	})
+	provider, err = other.migrationsProvider()
+	require.NoError(t, err)
+	assert.Len(t, provider.ListSources(), 1)
+
+	// Go files are checked for conflicts as well
+	db.setFS(fstest.MapFS{
+		"sql/00001_first.sql":        &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+		"sql/00001_backfill.go":      &fstest.MapFile{Data: []byte("package migrations")},
+		"sql/00002_backfill.go":      &fstest.MapFile{Data: []byte("package migrations")},
+		"sql/00002_backfill_test.go": &fstest.MapFile{Data: []byte("package migrations")},
+	})
+	_, err = db.migrationsProvider()
+	assert.ErrorContains(t, err, "migration 00001_backfill.go conflicts with migration 00001_first.sql")
+	assert.NotContains(t, err.Error(), "00002")
+}
+
+func TestUpStopsBeforeHiddenGoMigrations(t *testing.T) {
+	sqlDB := testutil.OpenSQLite(t)
+	migrations := fstest.MapFS{
+		"00001_first.sql":   &fstest.MapFile{Data: []byte("-- +goose Up\nCREATE TABLE first (id INTEGER);")},
+		"00002_backfill.go": &fstest.MapFile{Data: []byte("package migrations")},
+		"00003_third.sql":   &fstest.MapFile{Data: []byte("-- +goose Up\nCREATE TABLE third (id INTEGER);")},
+	}
+	db := &DB{DB: sqlDB, conf: DBConfig{Driver: "sqlite"}}
+	db.conf.Migrations.Path = "."
+	db.setFS(migrations)
+
+	// The migrations following the hidden one are not applied, or it would be skipped for good
+	err := db.Up()
+	assert.ErrorContains(t, err, "migration 2 is a Go migration which isn't registered")
+	version, err := db.Version()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+	assert.ErrorContains(t, db.UpTo(context.Background(), 3), "migration 2")
+	require.NoError(t, db.UpTo(context.Background(), 1))
+
+	// Once the application binary applied it, the rest can run
+	noop := func(ctx context.Context, tx *sql.Tx) error { return nil }
+	app := &DB{DB: sqlDB, conf: db.conf, goMigrations: []GoMigration{{Version: 2, UpTx: noop, DownTx: noop}}}
+	app.setFS(migrations)
+	require.NoError(t, app.UpTo(context.Background(), 2))
+
+	require.NoError(t, db.Up())
+	version, err = db.Version()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+}
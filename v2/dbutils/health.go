@@ -0,0 +1,88 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HealthStatus is the overall status reported by DB.Health
+type HealthStatus string
+
+const (
+	HealthOK          HealthStatus = "ok"
+	HealthUnavailable HealthStatus = "unavailable"
+)
+
+// HealthTimeout bounds the time spent by DB.Health, unless the given context expires earlier
+var HealthTimeout = 2 * time.Second
+
+// HealthReport describes the state of a DB, as returned by DB.Health
+type HealthReport struct {
+	Status HealthStatus `json:"status" doc:"ok if the DB is reachable, unavailable otherwise"`
+	Error  string       `json:"error,omitempty" doc:"The reason why the DB is unavailable"`
+	// Version is the highest applied migration version, or -1 when the DB has no migrations file system
+	Version           int64       `json:"version" doc:"The current migration version"`
+	PendingMigrations int         `json:"pendingMigrations" doc:"The number of migrations not applied yet"`
+	Stats             sql.DBStats `json:"stats" doc:"The connection pool statistics"`
+}
+
+// Health pings the DB and reports its migration state along with the pool statistics
+func (d *DB) Health(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, HealthTimeout)
+	defer cancel()
+
+	report := HealthReport{
+		Status:  HealthOK,
+		Version: -1,
+	}
+
+	err := d.PingContext(ctx)
+	// The statistics are taken after the ping, so that they include its connection
+	report.Stats = d.Stats()
+	if err != nil {
+		report.Status = HealthUnavailable
+		report.Error = fmt.Sprintf("ping: %s", err)
+		return report
+	}
+
+	if d.fsys == nil {
+		return report
+	}
+
+	statuses, err := d.Status(ctx)
+	if err != nil {
+		report.Status = HealthUnavailable
+		report.Error = fmt.Sprintf("migrations status: %s", err)
+		return report
+	}
+	report.Version = 0
+	for _, s := range statuses {
+		switch s.State {
+		case MigrationApplied:
+			report.Version = max(report.Version, s.Version)
+		case MigrationPending:
+			report.PendingMigrations++
+		}
+	}
+
+	return report
+}
+
+// HealthHandler serves DB.Health as JSON, with a 503 status code when the DB is unavailable
+// It's meant to be used as a Kubernetes readiness or liveness probe
+func (d *DB) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := d.Health(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != HealthOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
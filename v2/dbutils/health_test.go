@@ -0,0 +1,58 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestHealthUnavailable(t *testing.T) {
+	sqlDB, err := sql.Open(testutil.FailingDriverName, "")
+	require.NoError(t, err)
+	db := &DB{DB: sqlDB}
+	defer db.Close()
+
+	report := db.Health(context.Background())
+	assert.Equal(t, HealthUnavailable, report.Status)
+	assert.Contains(t, report.Error, "connection refused")
+	assert.Equal(t, int64(-1), report.Version)
+
+	rec := httptest.NewRecorder()
+	db.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body HealthReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, HealthUnavailable, body.Status)
+}
+
+func TestHealthMigrations(t *testing.T) {
+	db := &DB{DB: testutil.OpenSQLite(t), conf: DBConfig{Driver: "sqlite"}}
+	defer db.Close()
+	db.setFS(fstest.MapFS{
+		"00001_first.sql":  &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+		"00002_second.sql": &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 2;")},
+	})
+	db.conf.Migrations.Path = "."
+
+	report := db.Health(context.Background())
+	assert.Equal(t, HealthOK, report.Status)
+	assert.Equal(t, int64(0), report.Version)
+	assert.Equal(t, 2, report.PendingMigrations)
+	assert.Positive(t, report.Stats.OpenConnections)
+
+	require.NoError(t, db.UpTo(context.Background(), 1))
+	report = db.Health(context.Background())
+	assert.Equal(t, HealthOK, report.Status)
+	assert.Equal(t, int64(1), report.Version)
+	assert.Equal(t, 1, report.PendingMigrations)
+}
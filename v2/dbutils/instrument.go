@@ -0,0 +1,138 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/top-solution/go-libs/v2/dbutils/querystats"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Instrumenter wraps executors in order to log slow queries, count queries per request and trace them
+// Its zero value counts queries only: set the fields to enable the rest
+type Instrumenter struct {
+	// SlowThreshold is the duration over which a query is logged as slow: 0 disables slow query logging
+	SlowThreshold time.Duration
+	// Logger is used to log slow and failed queries (slog.Default() if nil)
+	Logger *slog.Logger
+	// RedactArgs returns the query args as they should be logged: if nil, args are always redacted
+	RedactArgs func(query string, args []any) []any
+	// Tracer, if set, is used to wrap every query in an OpenTelemetry span
+	Tracer trace.Tracer
+	// System is reported as the db.system span attribute, i.e. "postgresql"
+	System string
+}
+
+// ShowArgs is a RedactArgs implementation which logs the args as they are: only use it in development
+func ShowArgs(_ string, args []any) []any {
+	return args
+}
+
+// Wrap returns an executor which instruments every query run by exec
+// The result can be used with sqlboiler as-is, and with bob via bob_helpers.Executor
+func (i *Instrumenter) Wrap(exec ContextExecutor) ContextExecutor {
+	return &instrumentedExecutor{exec: exec, instrumenter: i}
+}
+
+// TxOr is the instrumented version of TxOr: it wraps either the transaction from ctx or the fallback executor
+func (i *Instrumenter) TxOr(ctx context.Context, fallback ContextExecutor) ContextExecutor {
+	return i.Wrap(TxOr(ctx, fallback))
+}
+
+// start is called before running a query: the returned function must be called with the query result
+func (i *Instrumenter) start(ctx context.Context, operation string, query string, args []any) (context.Context, func(error)) {
+	var span trace.Span
+	if i.Tracer != nil {
+		attrs := []attribute.KeyValue{
+			attribute.String("db.operation", operation),
+			attribute.String("db.statement", query),
+		}
+		if i.System != "" {
+			attrs = append(attrs, attribute.String("db.system", i.System))
+		}
+		ctx, span = i.Tracer.Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	}
+
+	start := time.Now()
+	return ctx, func(err error) {
+		elapsed := time.Since(start)
+
+		if stats := querystats.FromContext(ctx); stats != nil {
+			stats.Record(query, elapsed)
+		}
+
+		if span != nil {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+
+		logger := i.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		switch {
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			logger.ErrorContext(ctx, "query failed", "query", query, "args", i.redact(query, args), "elapsed", elapsed, "err", err)
+		case i.SlowThreshold > 0 && elapsed > i.SlowThreshold:
+			logger.WarnContext(ctx, "slow query", "query", query, "args", i.redact(query, args), "elapsed", elapsed)
+		}
+	}
+}
+
+func (i *Instrumenter) redact(query string, args []any) any {
+	if i.RedactArgs == nil {
+		if len(args) == 0 {
+			return nil
+		}
+		return fmt.Sprintf("[%d redacted]", len(args))
+	}
+	return i.RedactArgs(query, args)
+}
+
+// instrumentedExecutor is a ContextExecutor instrumented by an Instrumenter
+type instrumentedExecutor struct {
+	exec         ContextExecutor
+	instrumenter *Instrumenter
+}
+
+func (e *instrumentedExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return e.ExecContext(context.Background(), query, args...)
+}
+
+func (e *instrumentedExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return e.QueryContext(context.Background(), query, args...)
+}
+
+func (e *instrumentedExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	return e.QueryRowContext(context.Background(), query, args...)
+}
+
+func (e *instrumentedExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := e.instrumenter.start(ctx, "exec", query, args)
+	res, err := e.exec.ExecContext(ctx, query, args...)
+	done(err)
+	return res, err
+}
+
+func (e *instrumentedExecutor) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := e.instrumenter.start(ctx, "query", query, args)
+	rows, err := e.exec.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+func (e *instrumentedExecutor) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := e.instrumenter.start(ctx, "query", query, args)
+	row := e.exec.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
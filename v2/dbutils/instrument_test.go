@@ -0,0 +1,108 @@
+package dbutils
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/top-solution/go-libs/v2/dbutils/querystats"
+)
+
+// fakeExecutor is a ContextExecutor which takes delay to run any query, failing with err
+type fakeExecutor struct {
+	delay time.Duration
+	err   error
+}
+
+func (f fakeExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return f.ExecContext(context.Background(), query, args...)
+}
+
+func (f fakeExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return f.QueryContext(context.Background(), query, args...)
+}
+
+func (f fakeExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	return f.QueryRowContext(context.Background(), query, args...)
+}
+
+func (f fakeExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	time.Sleep(f.delay)
+	return nil, f.err
+}
+
+func (f fakeExecutor) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	time.Sleep(f.delay)
+	return nil, f.err
+}
+
+func (f fakeExecutor) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	time.Sleep(f.delay)
+	return &sql.Row{}
+}
+
+func TestInstrumenter(t *testing.T) {
+	var logs bytes.Buffer
+	instrumenter := &Instrumenter{
+		SlowThreshold: 5 * time.Millisecond,
+		Logger:        slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+
+	ctx, stats := querystats.NewContext(context.Background())
+
+	fast := instrumenter.Wrap(fakeExecutor{})
+	_, _ = fast.ExecContext(ctx, "UPDATE users SET name = $1", "secret")
+	_ = fast.QueryRowContext(ctx, "SELECT 1")
+	assert.Empty(t, logs.String(), "fast queries are not logged")
+
+	slow := instrumenter.Wrap(fakeExecutor{delay: 10 * time.Millisecond})
+	_, _ = slow.QueryContext(ctx, "SELECT * FROM users WHERE name = $1", "secret")
+	assert.Contains(t, logs.String(), "slow query")
+	assert.Contains(t, logs.String(), "[1 redacted]")
+	assert.NotContains(t, logs.String(), "secret")
+
+	logs.Reset()
+	failing := instrumenter.Wrap(fakeExecutor{err: errors.New("boom")})
+	_, _ = failing.ExecContext(ctx, "DELETE FROM users")
+	assert.Contains(t, logs.String(), "query failed")
+
+	assert.Equal(t, 4, stats.Count())
+	assert.GreaterOrEqual(t, stats.Duration(), 10*time.Millisecond)
+
+	// Contexts without stats are fine too
+	_, err := fast.ExecContext(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.Count())
+}
+
+func TestInstrumenterShowArgs(t *testing.T) {
+	var logs bytes.Buffer
+	instrumenter := &Instrumenter{
+		SlowThreshold: time.Nanosecond,
+		Logger:        slog.New(slog.NewTextHandler(&logs, nil)),
+		RedactArgs:    ShowArgs,
+	}
+	_, _ = instrumenter.Wrap(fakeExecutor{delay: time.Millisecond}).Exec("SELECT $1", "visible")
+	assert.Contains(t, logs.String(), "visible")
+}
+
+func TestQueryStatsStatements(t *testing.T) {
+	ctx, stats := querystats.NewContext(context.Background())
+	exec := (&Instrumenter{}).Wrap(fakeExecutor{})
+
+	for i := range 3 {
+		_, _ = exec.ExecContext(ctx, "SELECT * FROM pets WHERE owner_id = $1", i)
+	}
+	_, _ = exec.ExecContext(ctx, "SELECT * FROM owners")
+
+	assert.Equal(t, 4, stats.Count())
+	assert.Equal(t, map[string]int{
+		"SELECT * FROM pets WHERE owner_id = ?": 3,
+		"SELECT * FROM owners":                  1,
+	}, stats.Statements())
+}
@@ -0,0 +1,234 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// ErrLockNotAcquired is returned by TryLock and TryLockTx when the lock is held by someone else
+var ErrLockNotAcquired = errors.New("lock not acquired")
+
+// ErrLockUnsupported is returned by the lock functions on SQLite, which has no named locks, and on unknown drivers:
+// several processes can open the same database file, so pretending to hold the lock would be unsafe
+var ErrLockUnsupported = errors.New("locks are not supported by the driver")
+
+// Conner can reserve a single connection from a pool: both *sql.DB and *DB implement it
+type Conner interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// SessionLock is a database-level lock bound to a single connection
+// It must be released with Unlock, which also gives the connection back to the pool
+type SessionLock struct {
+	conn   *sql.Conn
+	driver DriverType
+	name   string
+}
+
+// TryLock tries to acquire a session-scoped lock named name, without waiting
+// It returns ErrLockNotAcquired if the lock is already held
+// The lock is implemented with pg_try_advisory_lock on Postgres and sp_getapplock on MSSQL, while SQLite returns ErrLockUnsupported
+func TryLock(ctx context.Context, db Conner, name string) (*SessionLock, error) {
+	return acquireSessionLock(ctx, db, name, false)
+}
+
+// Lock acquires a session-scoped lock named name, waiting until it's available or ctx is done
+// The lock is implemented with pg_advisory_lock on Postgres and sp_getapplock on MSSQL, while SQLite returns ErrLockUnsupported
+func Lock(ctx context.Context, db Conner, name string) (*SessionLock, error) {
+	return acquireSessionLock(ctx, db, name, true)
+}
+
+// WithLock runs fn while holding the session-scoped lock named name, waiting for it if needed
+func WithLock(ctx context.Context, db Conner, name string, fn func(ctx context.Context) error) (err error) {
+	lock, err := Lock(ctx, db, name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Unlock with a fresh context, so that a cancelled ctx doesn't leave the lock behind
+		unlockErr := lock.Unlock(context.WithoutCancel(ctx))
+		if unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+	return fn(ctx)
+}
+
+// TryLockTx tries to acquire a transaction-scoped lock named name, without waiting
+// It returns ErrLockNotAcquired if the lock is already held
+// The lock is released automatically when the transaction commits or rolls back
+// driver is the driver of the DB the transaction belongs to, i.e. db.DriverType()
+func TryLockTx(ctx context.Context, driver DriverType, tx *sql.Tx, name string) error {
+	return acquireTxLock(ctx, tx, driver, name, false)
+}
+
+// LockTx acquires a transaction-scoped lock named name, waiting until it's available or ctx is done
+// The lock is released automatically when the transaction commits or rolls back
+// driver is the driver of the DB the transaction belongs to, i.e. db.DriverType()
+func LockTx(ctx context.Context, driver DriverType, tx *sql.Tx, name string) error {
+	return acquireTxLock(ctx, tx, driver, name, true)
+}
+
+// Name returns the name of the lock
+func (l *SessionLock) Name() string {
+	return l.name
+}
+
+// Unlock releases the lock and returns the underlying connection to the pool
+func (l *SessionLock) Unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return errors.New("unlock: lock already released")
+	}
+	conn := l.conn
+	l.conn = nil
+
+	var err error
+	switch l.driver {
+	case MSSQLDriver:
+		_, err = conn.ExecContext(ctx, "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'", l.name)
+	default:
+		var released bool
+		err = conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey(l.name)).Scan(&released)
+		if err == nil && !released {
+			err = fmt.Errorf("lock %s was not held", l.name)
+		}
+	}
+	if err != nil {
+		// The lock may still be held by the session: make sure the connection is discarded instead of going back to the pool
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		_ = conn.Close()
+		return fmt.Errorf("unlock %s: %w", l.name, err)
+	}
+	return conn.Close()
+}
+
+func acquireSessionLock(ctx context.Context, db Conner, name string, wait bool) (*SessionLock, error) {
+	driver := DriverOf(db)
+	if driver != PostgresDriver && driver != MSSQLDriver {
+		return nil, fmt.Errorf("lock %s: %w", name, ErrLockUnsupported)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get connection: %w", err)
+	}
+	lock := &SessionLock{conn: conn, driver: driver, name: name}
+
+	var acquired bool
+	switch lock.driver {
+	case MSSQLDriver:
+		acquired, err = getAppLock(ctx, conn, name, "Session", wait)
+	default:
+		acquired, err = advisoryLock(ctx, conn, "pg_advisory_lock", "pg_try_advisory_lock", name, wait)
+	}
+	if err != nil || !acquired {
+		conn.Close()
+		if err != nil {
+			return nil, fmt.Errorf("lock %s: %w", name, err)
+		}
+		return nil, ErrLockNotAcquired
+	}
+
+	return lock, nil
+}
+
+func acquireTxLock(ctx context.Context, tx *sql.Tx, driverType DriverType, name string, wait bool) error {
+	var acquired bool
+	var err error
+	switch driverType {
+	case MSSQLDriver:
+		acquired, err = getAppLock(ctx, tx, name, "Transaction", wait)
+	case PostgresDriver:
+		acquired, err = advisoryLock(ctx, tx, "pg_advisory_xact_lock", "pg_try_advisory_xact_lock", name, wait)
+	default:
+		return fmt.Errorf("lock %s: %w", name, ErrLockUnsupported)
+	}
+	if err != nil {
+		return fmt.Errorf("lock %s: %w", name, err)
+	}
+	if !acquired {
+		return ErrLockNotAcquired
+	}
+	return nil
+}
+
+// lockExecutor is the subset of ContextExecutor implemented by *sql.Conn and *sql.Tx alike
+type lockExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// advisoryLock calls either the blocking or the non-blocking Postgres advisory lock function
+func advisoryLock(ctx context.Context, exec lockExecutor, lockFunc, tryLockFunc string, name string, wait bool) (bool, error) {
+	if wait {
+		_, err := exec.ExecContext(ctx, "SELECT "+lockFunc+"($1)", lockKey(name))
+		return err == nil, err
+	}
+	var acquired bool
+	err := exec.QueryRowContext(ctx, "SELECT "+tryLockFunc+"($1)", lockKey(name)).Scan(&acquired)
+	return acquired, err
+}
+
+// getAppLock calls sp_getapplock, waiting indefinitely if wait is true
+// See https://learn.microsoft.com/en-us/sql/relational-databases/system-stored-procedures/sp-getapplock-transact-sql
+func getAppLock(ctx context.Context, exec lockExecutor, name string, owner string, wait bool) (bool, error) {
+	timeout := 0
+	if wait {
+		timeout = -1
+	}
+	var result int
+	err := exec.QueryRowContext(ctx, `DECLARE @result int;
+EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = '`+owner+`', @LockTimeout = @p2;
+SELECT @result`, name, timeout).Scan(&result)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case result >= 0:
+		return true, nil
+	case result == -1:
+		// Timed out
+		return false, nil
+	default:
+		return false, fmt.Errorf("sp_getapplock returned %d", result)
+	}
+}
+
+// lockKey maps a lock name to the int64 key expected by Postgres advisory locks
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// DriverOf guesses the driver type of a connection pool, returning an empty DriverType if unknown
+// Executors wrapping a pool can implement DriverType() to report its driver
+func DriverOf(db any) DriverType {
+	switch d := db.(type) {
+	case interface{ DriverType() DriverType }:
+		return d.DriverType()
+	case interface{ Driver() driver.Driver }:
+		name := fmt.Sprintf("%T", d.Driver())
+		switch {
+		case strings.Contains(name, "mssql"):
+			return MSSQLDriver
+		case strings.HasPrefix(name, "*pq.") || strings.HasPrefix(name, "*stdlib."):
+			return PostgresDriver
+		case strings.HasPrefix(name, "*sqlite."):
+			return SQLiteDriver
+		}
+	}
+	return ""
+}
+
+// normalizeDriver maps a configured driver name to its DriverType
+func normalizeDriver(name string) DriverType {
+	if name == "mssql" {
+		return MSSQLDriver
+	}
+	return DriverType(name)
+}
@@ -0,0 +1,60 @@
+package dbutils_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/dbutils"
+	"github.com/top-solution/go-libs/v2/dbutils/dbtest"
+)
+
+// openLockDB returns the dbtest DB, skipping the test on SQLite which has no locks
+func openLockDB(t *testing.T) *dbutils.DB {
+	conf, err := dbtest.Config()
+	require.NoError(t, err)
+	if conf.Driver == string(dbutils.SQLiteDriver) {
+		t.Skipf("locks need a server: set %s and %s", dbtest.DriverEnv, dbtest.DSNEnv)
+	}
+	return dbtest.Open(t, nil)
+}
+
+func TestSessionLock(t *testing.T) {
+	db := openLockDB(t)
+	ctx := context.Background()
+
+	lock, err := dbutils.TryLock(ctx, db, "dbutils-test-session")
+	require.NoError(t, err)
+
+	_, err = dbutils.TryLock(ctx, db, "dbutils-test-session")
+	assert.ErrorIs(t, err, dbutils.ErrLockNotAcquired)
+
+	other, err := dbutils.TryLock(ctx, db, "dbutils-test-other")
+	require.NoError(t, err)
+	assert.NoError(t, other.Unlock(ctx))
+
+	assert.NoError(t, lock.Unlock(ctx))
+	lock, err = dbutils.TryLock(ctx, db, "dbutils-test-session")
+	require.NoError(t, err)
+	assert.NoError(t, lock.Unlock(ctx))
+}
+
+func TestTxLock(t *testing.T) {
+	db := openLockDB(t)
+	ctx := context.Background()
+
+	tx1, err := db.Begin()
+	require.NoError(t, err)
+	defer tx1.Rollback()
+	require.NoError(t, dbutils.TryLockTx(ctx, db.DriverType(), tx1, "dbutils-test-tx"))
+
+	tx2, err := db.Begin()
+	require.NoError(t, err)
+	defer tx2.Rollback()
+	assert.ErrorIs(t, dbutils.TryLockTx(ctx, db.DriverType(), tx2, "dbutils-test-tx"), dbutils.ErrLockNotAcquired)
+
+	// The lock is released along with the transaction
+	require.NoError(t, tx1.Rollback())
+	assert.NoError(t, dbutils.TryLockTx(ctx, db.DriverType(), tx2, "dbutils-test-tx"))
+}
@@ -0,0 +1,47 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockKey(t *testing.T) {
+	assert.Equal(t, lockKey("migrations"), lockKey("migrations"))
+	assert.NotEqual(t, lockKey("migrations"), lockKey("cleanup"))
+}
+
+func TestDriverOf(t *testing.T) {
+	sqlDB, err := sql.Open("postgres", "postgres://localhost")
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+
+	assert.Equal(t, PostgresDriver, DriverOf(sqlDB))
+	assert.Equal(t, MSSQLDriver, DriverOf(&DB{DB: sqlDB, conf: DBConfig{Driver: "mssql"}}))
+	assert.Equal(t, MSSQLDriver, DriverOf(&DB{DB: sqlDB, conf: DBConfig{Driver: "sqlserver"}}))
+
+	sqliteDB, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	defer sqliteDB.Close()
+	assert.Equal(t, SQLiteDriver, DriverOf(sqliteDB))
+}
+
+func TestLockUnsupported(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	assert.NoError(t, err)
+	defer sqlDB.Close()
+	ctx := context.Background()
+
+	_, err = TryLock(ctx, sqlDB, "migrations")
+	assert.ErrorIs(t, err, ErrLockUnsupported)
+	_, err = Lock(ctx, sqlDB, "migrations")
+	assert.ErrorIs(t, err, ErrLockUnsupported)
+
+	tx, err := sqlDB.Begin()
+	assert.NoError(t, err)
+	defer tx.Rollback()
+	assert.ErrorIs(t, LockTx(ctx, SQLiteDriver, tx, "migrations"), ErrLockUnsupported)
+}
@@ -0,0 +1,347 @@
+package dbutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+)
+
+// MigrationState is the state of a single migration
+type MigrationState string
+
+const (
+	MigrationApplied MigrationState = "applied"
+	MigrationPending MigrationState = "pending"
+)
+
+// MigrationType is the kind of migration file created by Create
+type MigrationType string
+
+const (
+	MigrationTypeSQL MigrationType = "sql"
+	MigrationTypeGo  MigrationType = "go"
+)
+
+// MigrationStatus describes a known migration, and whether it was applied or not
+type MigrationStatus struct {
+	Version int64          `json:"version"`
+	Source  string         `json:"source"`
+	State   MigrationState `json:"state"`
+	// AppliedAt is the zero time for pending migrations
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// setFS replaces the migrations file system, discarding the provider built from the previous one
+func (d *DB) setFS(fsys fs.FS) {
+	d.providerMu.Lock()
+	defer d.providerMu.Unlock()
+	d.fsys = fsys
+	d.provider = nil
+}
+
+// migrationsProvider returns the goose provider owned by this DB, building it on first use
+// Each DB has its own provider, so multiple DBs never share dialect, table or file system
+func (d *DB) migrationsProvider() (*goose.Provider, error) {
+	d.providerMu.Lock()
+	defer d.providerMu.Unlock()
+	if d.provider != nil {
+		return d.provider, nil
+	}
+	if d.fsys == nil {
+		return nil, errors.New("can't run migrations: no file system was passed to Open()")
+	}
+
+	migrationsFS, err := fs.Sub(d.fsys, path.Clean(d.conf.Migrations.Path))
+	if err != nil {
+		return nil, fmt.Errorf("migrations path: %w", err)
+	}
+	store, err := database.NewStore(migrationsDialect(d.conf.Driver), d.migrationsTable())
+	if err != nil {
+		return nil, fmt.Errorf("migrations store: %w", err)
+	}
+	goMigrations := gooseGoMigrations(d.goMigrations)
+	err = checkGoMigrationConflicts(migrationsFS, goMigrations)
+	if err != nil {
+		return nil, err
+	}
+	d.hiddenMigrations, err = hiddenGoMigrations(migrationsFS, goMigrations)
+	if err != nil {
+		return nil, err
+	}
+	// The dialect must be empty when passing a store: the store already knows it
+	d.provider, err = goose.NewProvider("", d.DB, sqlMigrationsFS{migrationsFS}, goose.WithStore(store), goose.WithGoMigrations(goMigrations...))
+	if err != nil {
+		return nil, fmt.Errorf("migrations provider: %w", err)
+	}
+	return d.provider, nil
+}
+
+// sqlMigrationsFS hides the Go files of the migrations directory from goose, which would reject them as unregistered
+// when they aren't built into the running binary, i.e. in cmd/migrate: Go migrations only run from the application binary,
+// which passes them to WithGoMigrations
+type sqlMigrationsFS struct {
+	fs.FS
+}
+
+func (f sqlMigrationsFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(entries, func(e fs.DirEntry) bool {
+		return path.Ext(e.Name()) == ".go"
+	}), nil
+}
+
+// DefaultMigrationsLockTimeout is how long to wait for the migrations lock when LockTimeout is 0
+const DefaultMigrationsLockTimeout = 5 * time.Minute
+
+// withMigrationsLock runs fn with ctx while holding the cluster-wide migrations lock
+// Only the wait for the lock is bound by the configured LockTimeout, not the migrations themselves
+func (d *DB) withMigrationsLock(ctx context.Context, fn func(ctx context.Context, provider *goose.Provider) error) error {
+	provider, err := d.migrationsProvider()
+	if err != nil {
+		return err
+	}
+
+	// SQLite has no named locks: it's meant for tests and tools, where a single process runs the migrations
+	if d.DriverType() == SQLiteDriver {
+		return fn(ctx, provider)
+	}
+
+	lockCtx := ctx
+	if timeout := d.migrationsLockTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	lock, err := Lock(lockCtx, d, "goose-migrations:"+d.migrationsTable())
+	if err != nil {
+		return fmt.Errorf("acquire migrations lock: %w", err)
+	}
+	defer func() {
+		// The lock is released even if ctx is done, since the session would keep holding it
+		err := lock.Unlock(context.WithoutCancel(ctx))
+		if err != nil {
+			slog.Error("unable to release the migrations lock", "lock", lock.Name(), "err", err)
+		}
+	}()
+
+	return fn(ctx, provider)
+}
+
+// migrationsLockTimeout returns the configured LockTimeout, defaulting to DefaultMigrationsLockTimeout when 0
+// A negative result means waiting forever
+func (d *DB) migrationsLockTimeout() time.Duration {
+	if d.conf.Migrations.LockTimeout == 0 {
+		return DefaultMigrationsLockTimeout
+	}
+	return d.conf.Migrations.LockTimeout
+}
+
+func (d *DB) up(ctx context.Context) error {
+	return d.withMigrationsLock(ctx, func(ctx context.Context, provider *goose.Provider) error {
+		return d.upTo(ctx, provider, goose.MaxVersion)
+	})
+}
+
+// UpTo runs the migrations up to the given version
+// Like Up, it stops before the first pending Go migration not registered with WithGoMigrations, returning an error
+func (d *DB) UpTo(ctx context.Context, version int64) error {
+	err := d.withMigrationsLock(ctx, func(ctx context.Context, provider *goose.Provider) error {
+		return d.upTo(ctx, provider, version)
+	})
+	if err != nil {
+		return fmt.Errorf("running db migrations up to %d: %w", version, err)
+	}
+	return nil
+}
+
+// upTo applies the migrations up to version, stopping before the first pending hidden Go migration:
+// applying the later ones would skip it for good, since goose refuses to apply migrations older than the DB version
+func (d *DB) upTo(ctx context.Context, provider *goose.Provider, version int64) error {
+	current, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	var hidden int64
+	for _, v := range d.hiddenMigrations {
+		if v > current && v <= version {
+			hidden = v
+			version = v - 1
+			break
+		}
+	}
+
+	// goose rejects versions lower than 1, i.e. when the first migration is hidden
+	if version > 0 {
+		results, err := provider.UpTo(ctx, version)
+		logMigrationResults(results...)
+		if err != nil {
+			return err
+		}
+	}
+	if hidden != 0 {
+		return fmt.Errorf("migration %d is a Go migration which isn't registered with WithGoMigrations: "+
+			"it must be applied by the application binary before the later migrations", hidden)
+	}
+	return nil
+}
+
+// Down rolls back the latest applied migration
+func (d *DB) Down(ctx context.Context) error {
+	err := d.withMigrationsLock(ctx, func(ctx context.Context, provider *goose.Provider) error {
+		result, err := provider.Down(ctx)
+		logMigrationResults(result)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("rolling back db migration: %w", err)
+	}
+	return nil
+}
+
+// DownTo rolls back the migrations down to the given version, which is kept
+func (d *DB) DownTo(ctx context.Context, version int64) error {
+	err := d.withMigrationsLock(ctx, func(ctx context.Context, provider *goose.Provider) error {
+		results, err := provider.DownTo(ctx, version)
+		logMigrationResults(results...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("rolling back db migrations down to %d: %w", version, err)
+	}
+	return nil
+}
+
+// Redo rolls back the latest applied migration, then applies it again
+func (d *DB) Redo(ctx context.Context) error {
+	err := d.withMigrationsLock(ctx, func(ctx context.Context, provider *goose.Provider) error {
+		result, err := provider.Down(ctx)
+		logMigrationResults(result)
+		if err != nil {
+			return err
+		}
+		result, err = provider.ApplyVersion(ctx, result.Source.Version, true)
+		logMigrationResults(result)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("redoing db migration: %w", err)
+	}
+	return nil
+}
+
+// Reset rolls back all the applied migrations
+func (d *DB) Reset(ctx context.Context) error {
+	err := d.withMigrationsLock(ctx, func(ctx context.Context, provider *goose.Provider) error {
+		results, err := provider.DownTo(ctx, 0)
+		logMigrationResults(results...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("resetting db migrations: %w", err)
+	}
+	return nil
+}
+
+// Status returns the list of known migrations, sorted by version, along with their state
+func (d *DB) Status(ctx context.Context) ([]MigrationStatus, error) {
+	provider, err := d.migrationsProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrations status: %w", err)
+	}
+
+	result := make([]MigrationStatus, 0, len(statuses))
+	for _, s := range statuses {
+		status := MigrationStatus{
+			Version: s.Source.Version,
+			Source:  s.Source.Path,
+			State:   MigrationPending,
+		}
+		if s.State == goose.StateApplied {
+			status.State = MigrationApplied
+			status.AppliedAt = s.AppliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Create scaffolds a new timestamped migration file named name inside the configured migrations path
+// Unlike the other commands, it writes to the OS file system, since fs.FS is read-only
+func (d *DB) Create(name string, migrationType MigrationType) error {
+	return CreateMigration(d.conf.Migrations.Path, name, migrationType)
+}
+
+// CreateMigration scaffolds a new timestamped migration file named name inside dir
+// Go migrations must be passed to WithGoMigrations by the application binary, which is the only one running them:
+// the other tools, like cmd/migrate, skip the Go files of the migrations directory
+func CreateMigration(dir string, name string, migrationType MigrationType) error {
+	if migrationType != MigrationTypeSQL && migrationType != MigrationTypeGo {
+		return fmt.Errorf("unsupported migration type: %s", migrationType)
+	}
+	var tmpl *template.Template
+	if migrationType == MigrationTypeGo {
+		tmpl = goMigrationTemplate
+	}
+	err := goose.CreateWithTemplate(nil, dir, tmpl, name, string(migrationType))
+	if err != nil {
+		return fmt.Errorf("create migration: %w", err)
+	}
+	return nil
+}
+
+// migrationsTable returns the goose version table name, qualified with the schema when hinted by the configuration
+func (d *DB) migrationsTable() string {
+	tableName := goose.DefaultTablename
+	if d.conf.Schema != "" {
+		schema, _, _ := strings.Cut(d.conf.Schema, ",")
+		tableName = schema + "." + tableName
+	}
+	return tableName
+}
+
+// migrationsDialect maps a driver name to the goose dialect
+// Note that goose wants "mssql" as dialect, while the driver is called "sqlserver"
+func migrationsDialect(driver string) database.Dialect {
+	switch normalizeDriver(driver) {
+	case MSSQLDriver:
+		return database.DialectMSSQL
+	case PostgresDriver:
+		return database.DialectPostgres
+	case SQLiteDriver:
+		return database.DialectSQLite3
+	default:
+		return database.Dialect(driver)
+	}
+}
+
+func logMigrationResults(results ...*goose.MigrationResult) {
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		if r.Error != nil {
+			slog.Error("migration failed", "direction", r.Direction, "source", r.Source.Path, "err", r.Error)
+			continue
+		}
+		slog.Info("migration applied", "direction", r.Direction, "source", r.Source.Path, "duration", r.Duration)
+	}
+}
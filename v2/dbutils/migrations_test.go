@@ -0,0 +1,108 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsProviderIsPerDB(t *testing.T) {
+	sqlDB, err := sql.Open("postgres", "postgres://localhost")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	first := &DB{DB: sqlDB, conf: DBConfig{Driver: "postgres"}}
+	first.conf.Migrations.Path = "sql"
+	first.setFS(fstest.MapFS{
+		"sql/00001_first.sql":  &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+		"sql/00002_second.sql": &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+	})
+
+	second := &DB{DB: sqlDB, conf: DBConfig{Driver: "sqlserver", Schema: "other,public"}}
+	second.conf.Migrations.Path = "./migrations"
+	second.setFS(fstest.MapFS{
+		"migrations/00010_other.sql": &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+	})
+
+	firstProvider, err := first.migrationsProvider()
+	require.NoError(t, err)
+	secondProvider, err := second.migrationsProvider()
+	require.NoError(t, err)
+
+	assert.Len(t, firstProvider.ListSources(), 2)
+	assert.Len(t, secondProvider.ListSources(), 1)
+	assert.Equal(t, int64(10), secondProvider.ListSources()[0].Version)
+
+	assert.Equal(t, "goose_db_version", first.migrationsTable())
+	assert.Equal(t, "other.goose_db_version", second.migrationsTable())
+}
+
+func TestMigrationsProviderSkipsGoFiles(t *testing.T) {
+	sqlDB, err := sql.Open("postgres", "postgres://localhost")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := &DB{DB: sqlDB, conf: DBConfig{Driver: "postgres"}}
+	db.conf.Migrations.Path = "sql"
+	db.setFS(fstest.MapFS{
+		"sql/00001_first.sql":   &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+		"sql/00002_backfill.go": &fstest.MapFile{Data: []byte("package migrations")},
+	})
+	provider, err := db.migrationsProvider()
+	require.NoError(t, err)
+
+	sources := provider.ListSources()
+	require.Len(t, sources, 1)
+	assert.Equal(t, int64(1), sources[0].Version)
+}
+
+func TestMigrationsProviderWithoutFS(t *testing.T) {
+	db := &DB{conf: DBConfig{Driver: "postgres"}}
+	_, err := db.migrationsProvider()
+	assert.Error(t, err)
+}
+
+func TestWithMigrationsLockContext(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer sqlDB.Close()
+
+	db := &DB{DB: sqlDB, conf: DBConfig{Driver: "sqlite"}}
+	db.conf.Migrations.Path = "."
+	db.setFS(fstest.MapFS{
+		"00001_first.sql": &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;")},
+	})
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "caller")
+	err = db.withMigrationsLock(ctx, func(ctx context.Context, _ *goose.Provider) error {
+		assert.Equal(t, "caller", ctx.Value(key{}))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestMigrationsLockTimeout(t *testing.T) {
+	db := &DB{}
+	assert.Equal(t, DefaultMigrationsLockTimeout, db.migrationsLockTimeout())
+
+	db.conf.Migrations.LockTimeout = time.Minute
+	assert.Equal(t, time.Minute, db.migrationsLockTimeout())
+
+	db.conf.Migrations.LockTimeout = -1
+	assert.Negative(t, db.migrationsLockTimeout())
+}
+
+func TestMigrationsDialect(t *testing.T) {
+	assert.Equal(t, database.DialectPostgres, migrationsDialect("postgres"))
+	assert.Equal(t, database.DialectMSSQL, migrationsDialect("sqlserver"))
+	assert.Equal(t, database.DialectMSSQL, migrationsDialect("mssql"))
+	assert.Equal(t, database.DialectSQLite3, migrationsDialect("sqlite"))
+}
@@ -0,0 +1,116 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// RetryPolicy configures how OpenContext retries reaching the DB server, with an exponential backoff
+type RetryPolicy struct {
+	// MaxAttempts is the max number of connection attempts, including the first one: 0 means no limit
+	MaxAttempts int
+	// InitialBackoff is the wait after the first failed attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts: 0 means no cap
+	MaxBackoff time.Duration
+	// Multiplier grows the wait after each failed attempt: values lower than 1 are treated as 1
+	Multiplier float64
+	// MaxWait bounds the overall time spent reaching the DB server: 0 means no limit
+	MaxWait time.Duration
+}
+
+// DefaultRetryPolicy waits about 20 seconds overall before giving up
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    7,
+	InitialBackoff: time.Second,
+	MaxBackoff:     8 * time.Second,
+	Multiplier:     1.5,
+}
+
+// Backoff returns how long to wait after the given failed attempt (starting from 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := max(p.Multiplier, 1)
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(backoff)
+}
+
+// OpenOption customizes OpenContext
+type OpenOption func(*openOptions)
+
+type openOptions struct {
+	retry        RetryPolicy
+	logger       *slog.Logger
+	goMigrations []GoMigration
+}
+
+// WithRetryPolicy sets the policy used to retry reaching the DB server (DefaultRetryPolicy by default)
+func WithRetryPolicy(policy RetryPolicy) OpenOption {
+	return func(o *openOptions) {
+		o.retry = policy
+	}
+}
+
+// WithLogger sets the logger used to report connection attempts (slog.Default() by default)
+func WithLogger(logger *slog.Logger) OpenOption {
+	return func(o *openOptions) {
+		o.logger = logger
+	}
+}
+
+func newOpenOptions(opts ...OpenOption) openOptions {
+	options := openOptions{
+		retry:  DefaultRetryPolicy,
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// connect opens a pool and pings it until it succeeds, following the retry policy
+// Pools which failed to connect are closed before retrying
+func connect(ctx context.Context, driver string, connectionString string, options openOptions) (*sql.DB, error) {
+	if options.retry.MaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.retry.MaxWait)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		sqlDB, err := sql.Open(driver, connectionString)
+		if err != nil {
+			// Only happens with unknown drivers: retrying won't help
+			return nil, err
+		}
+		err = sqlDB.PingContext(ctx)
+		if err == nil {
+			options.logger.Debug("connected to DB server", "driver", driver, "attempt", attempt)
+			return sqlDB, nil
+		}
+		sqlDB.Close()
+
+		if options.retry.MaxAttempts > 0 && attempt >= options.retry.MaxAttempts {
+			options.logger.Error("unable to reach DB server: giving up", "driver", driver, "attempt", attempt, "err", err)
+			return nil, err
+		}
+
+		backoff := options.retry.Backoff(attempt)
+		options.logger.Warn("unable to reach DB server: retrying", "driver", driver, "attempt", attempt, "backoff", backoff, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+	}
+}
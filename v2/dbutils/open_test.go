@@ -0,0 +1,65 @@
+package dbutils
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+
+	// A multiplier lower than 1 means a constant backoff
+	policy = RetryPolicy{InitialBackoff: time.Second}
+	assert.Equal(t, time.Second, policy.Backoff(10))
+}
+
+func TestConnectRetries(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		testutil.Failing.Attempts.Store(0)
+		options := newOpenOptions(WithLogger(logger), WithRetryPolicy(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+		}))
+		_, err := connect(context.Background(), testutil.FailingDriverName, "", options)
+		assert.ErrorContains(t, err, "connection refused")
+		assert.Equal(t, int32(3), testutil.Failing.Attempts.Load())
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		options := newOpenOptions(WithLogger(logger), WithRetryPolicy(RetryPolicy{
+			InitialBackoff: time.Hour,
+		}))
+		start := time.Now()
+		_, err := connect(ctx, testutil.FailingDriverName, "", options)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("stops after max wait", func(t *testing.T) {
+		options := newOpenOptions(WithLogger(logger), WithRetryPolicy(RetryPolicy{
+			InitialBackoff: time.Hour,
+			MaxWait:        50 * time.Millisecond,
+		}))
+		_, err := connect(context.Background(), testutil.FailingDriverName, "", options)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("unknown driver", func(t *testing.T) {
+		_, err := connect(context.Background(), "unknown", "", newOpenOptions(WithLogger(logger)))
+		assert.Error(t, err)
+	})
+}
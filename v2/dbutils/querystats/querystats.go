@@ -0,0 +1,89 @@
+// Package querystats collects the queries run during a request
+// It only depends on the standard library, so that middlewares can count queries without importing dbutils and its drivers:
+// the queries are recorded by the executors wrapped by dbutils.Instrumenter
+package querystats
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats collects the number and duration of the queries run with a given context
+// It's safe for concurrent use
+type Stats struct {
+	mu       sync.Mutex
+	count    int
+	duration time.Duration
+	// statements counts the executions of each normalized statement
+	statements map[string]int
+}
+
+type statsKey struct{}
+
+// NewContext returns a context collecting the stats of the instrumented queries run with it, i.e. during a request
+func NewContext(ctx context.Context) (context.Context, *Stats) {
+	stats := &Stats{}
+	return context.WithValue(ctx, statsKey{}, stats), stats
+}
+
+// FromContext returns the stats collected in ctx, or nil if it doesn't collect any
+func FromContext(ctx context.Context) *Stats {
+	stats, _ := ctx.Value(statsKey{}).(*Stats)
+	return stats
+}
+
+// Count returns the number of queries run so far
+func (s *Stats) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Duration returns the overall time spent running queries so far
+func (s *Stats) Duration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.duration
+}
+
+// Statements returns how many times each statement was run, keyed by its NormalizeQuery form
+func (s *Stats) Statements() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.statements)
+}
+
+// Record adds a query which took elapsed to run to the stats
+func (s *Stats) Record(query string, elapsed time.Duration) {
+	normalized := NormalizeQuery(query)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.duration += elapsed
+	if s.statements == nil {
+		s.statements = map[string]int{}
+	}
+	s.statements[normalized]++
+}
+
+var (
+	stringLiteralRegex = regexp.MustCompile(`'(?:[^']|'')*'`)
+	placeholderRegex   = regexp.MustCompile(`\$\d+|@p\d+|\b\d+(?:\.\d+)?\b`)
+	valuesListRegex    = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	whitespaceRegex    = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeQuery reduces a query to its shape, so that the same statement run with different args looks the same:
+// literals and placeholders are replaced by ?, lists of them collapsed to (?), and whitespace is collapsed
+func NormalizeQuery(query string) string {
+	query = stringLiteralRegex.ReplaceAllString(query, "?")
+	query = placeholderRegex.ReplaceAllString(query, "?")
+	query = valuesListRegex.ReplaceAllString(query, "(?)")
+	query = whitespaceRegex.ReplaceAllString(query, " ")
+	return strings.TrimSpace(query)
+}
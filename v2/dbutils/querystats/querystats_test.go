@@ -0,0 +1,45 @@
+package querystats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM users WHERE id = $1", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT * FROM users WHERE id = @p12", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT *\n\tFROM users  WHERE name = 'O''Brien' AND age > 42", "SELECT * FROM users WHERE name = ? AND age > ?"},
+		{"SELECT * FROM users WHERE id IN ($1, $2, $3)", "SELECT * FROM users WHERE id IN (?)"},
+		{"SELECT * FROM users WHERE id IN (?,?)", "SELECT * FROM users WHERE id IN (?)"},
+		{"SELECT * FROM table1", "SELECT * FROM table1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, NormalizeQuery(tt.query), tt.query)
+	}
+}
+
+func TestStats(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+
+	ctx, stats := NewContext(context.Background())
+	assert.Same(t, stats, FromContext(ctx))
+
+	for range 3 {
+		stats.Record("SELECT * FROM pets WHERE owner_id = $1", time.Millisecond)
+	}
+	stats.Record("SELECT * FROM owners", time.Millisecond)
+
+	assert.Equal(t, 4, stats.Count())
+	assert.Equal(t, 4*time.Millisecond, stats.Duration())
+	assert.Equal(t, map[string]int{
+		"SELECT * FROM pets WHERE owner_id = ?": 3,
+		"SELECT * FROM owners":                  1,
+	}, stats.Statements())
+}
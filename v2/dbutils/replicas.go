@@ -0,0 +1,171 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replica is a read replica pool, along with its latest health check result
+type replica struct {
+	host    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// replicaSet load-balances the read replicas, health-checking them in the background
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	logger   *slog.Logger
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Reader returns an executor meant for read-only queries
+// It load-balances across the healthy read replicas, falling back to the primary when none is configured or healthy
+// Combine it with TxOr, i.e. TxOr(ctx, db.Reader()), so that queries inside a transaction keep using the primary
+func (d *DB) Reader() ContextExecutor {
+	if d.replicas == nil {
+		return d.DB
+	}
+	if r := d.replicas.pick(); r != nil {
+		return r.db
+	}
+	return d.DB
+}
+
+// Close closes the primary and the read replicas, stopping their health checks
+func (d *DB) Close() error {
+	var errs []error
+	if d.replicas != nil {
+		errs = append(errs, d.replicas.close())
+	}
+	errs = append(errs, d.DB.Close())
+	return errors.Join(errs...)
+}
+
+// openReplicas opens a pool for each replica host, sharing every other setting with the primary
+// Unlike the primary, a replica being down doesn't make Open fail: it's just excluded until healthy
+func openReplicas(ctx context.Context, conf DBConfig, options openOptions) (*replicaSet, error) {
+	if conf.DSN != "" {
+		return nil, errors.New("read replicas can't be used along with a raw DSN")
+	}
+
+	set := &replicaSet{logger: options.logger, stop: make(chan struct{})}
+	for _, host := range conf.Replicas.Hosts {
+		replicaConf, err := replicaConfig(conf, host)
+		if err != nil {
+			set.close()
+			return nil, err
+		}
+		sqlDB, err := sql.Open(conf.Driver, fromDBConfToConnectionString(replicaConf))
+		if err != nil {
+			set.close()
+			return nil, fmt.Errorf("replica %s: %w", host, err)
+		}
+		configurePool(sqlDB, conf)
+		set.replicas = append(set.replicas, &replica{host: host, db: sqlDB})
+	}
+
+	interval := conf.Replicas.HealthCheckInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	set.checkHealth(ctx, interval)
+	for _, r := range set.replicas {
+		if !r.healthy.Load() {
+			set.logger.Warn("read replica is unreachable: excluding it until healthy", "host", r.host)
+		}
+	}
+
+	set.wg.Add(1)
+	go func() {
+		defer set.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-set.stop:
+				return
+			case <-ticker.C:
+				set.checkHealth(context.Background(), interval)
+			}
+		}
+	}()
+
+	return set, nil
+}
+
+// replicaConfig returns the primary configuration pointing to the given replica host
+func replicaConfig(conf DBConfig, host string) (DBConfig, error) {
+	conf.Server = host
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return conf, fmt.Errorf("replica %s: invalid port: %w", host, err)
+		}
+		conf.Server = h
+		conf.Port = port
+	}
+	return conf, nil
+}
+
+// pick returns the next healthy replica in a round-robin fashion, or nil if none is healthy
+func (s *replicaSet) pick() *replica {
+	n := uint64(len(s.replicas))
+	for range n {
+		r := s.replicas[s.next.Add(1)%n]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// checkHealth pings every replica, waiting at most timeout for each
+func (s *replicaSet) checkHealth(ctx context.Context, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := r.db.PingContext(pingCtx)
+			wasHealthy := r.healthy.Swap(err == nil)
+			if err != nil && wasHealthy {
+				s.logger.Warn("read replica is unhealthy: falling back", "host", r.host, "err", err)
+			}
+			if err == nil && !wasHealthy {
+				s.logger.Info("read replica is healthy", "host", r.host)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// close stops the health checks and closes every replica pool
+func (s *replicaSet) close() error {
+	select {
+	case <-s.stop:
+		return nil
+	default:
+		close(s.stop)
+	}
+	s.wg.Wait()
+
+	var errs []error
+	for _, r := range s.replicas {
+		errs = append(errs, r.db.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestReplicaConfig(t *testing.T) {
+	conf := DBConfig{Driver: "postgres", Server: "primary", Port: 5432, DB: "databasename"}
+
+	replicaConf, err := replicaConfig(conf, "replica1:5433")
+	require.NoError(t, err)
+	assert.Equal(t, "replica1", replicaConf.Server)
+	assert.Equal(t, 5433, replicaConf.Port)
+	assert.Equal(t, "databasename", replicaConf.DB)
+
+	replicaConf, err = replicaConfig(conf, "replica2")
+	require.NoError(t, err)
+	assert.Equal(t, "replica2", replicaConf.Server)
+	assert.Equal(t, 5432, replicaConf.Port)
+}
+
+func TestReader(t *testing.T) {
+	primary, err := sql.Open(testutil.FailingDriverName, "primary")
+	require.NoError(t, err)
+	defer primary.Close()
+
+	db := &DB{DB: primary}
+	assert.Same(t, primary, db.Reader(), "no replicas configured")
+
+	var replicas []*replica
+	for _, host := range []string{"replica1", "replica2", "replica3"} {
+		sqlDB, err := sql.Open(testutil.FailingDriverName, host)
+		require.NoError(t, err)
+		defer sqlDB.Close()
+		replicas = append(replicas, &replica{host: host, db: sqlDB})
+	}
+	db.replicas = &replicaSet{
+		replicas: replicas,
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stop:     make(chan struct{}),
+	}
+	assert.Same(t, primary, db.Reader(), "no healthy replicas")
+
+	replicas[0].healthy.Store(true)
+	replicas[2].healthy.Store(true)
+	seen := map[ContextExecutor]int{}
+	for range 10 {
+		seen[db.Reader()]++
+	}
+	assert.Len(t, seen, 2)
+	assert.Equal(t, 5, seen[replicas[0].db])
+	assert.Equal(t, 5, seen[replicas[2].db])
+
+	// The failing driver can't be pinged: the health check excludes every replica
+	db.replicas.checkHealth(context.Background(), time.Second)
+	assert.Same(t, primary, db.Reader())
+}
@@ -0,0 +1,181 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// TenantSchemaPrefix is prepended to tenant names to get their schema
+var TenantSchemaPrefix = "tenant_"
+
+// tenantRegex restricts tenant names, so that schema names are always valid and never need quoting
+var tenantRegex = regexp.MustCompile(`^[a-z0-9_]{1,48}$`)
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose transactions run in the schema of tenant (Postgres only)
+// The search_path is set by Transaction for the new transactions only, once EnableTenantSearchPath has been called:
+// queries run outside of a transaction keep the default one
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set by WithTenant, or an empty string if none
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// TenantSchema returns the schema of tenant, which must only contain lowercase letters, digits and underscores
+func TenantSchema(tenant string) (string, error) {
+	if !tenantRegex.MatchString(tenant) {
+		return "", fmt.Errorf("invalid tenant name %q", tenant)
+	}
+	return TenantSchemaPrefix + tenant, nil
+}
+
+var enableTenantsOnce sync.Once
+
+// EnableTenantSearchPath registers the TxHook which sets the search_path of the transactions to the tenant set by WithTenant
+// It must be called once at startup by the applications using schema-per-tenant: calling it again has no effect
+func EnableTenantSearchPath() {
+	enableTenantsOnce.Do(func() {
+		RegisterTxHook(tenantSearchPathHook)
+	})
+}
+
+// tenantSearchPathHook is the TxHook registered by EnableTenantSearchPath
+func tenantSearchPathHook(ctx context.Context, tx *sql.Tx, driver DriverType) error {
+	return setTenantSearchPath(ctx, tx, driver, TenantFromContext(ctx))
+}
+
+// setTenantSearchPath sets the search_path of the current transaction to the tenant schema, followed by public
+func setTenantSearchPath(ctx context.Context, exec lockExecutor, driverType DriverType, tenant string) error {
+	if tenant == "" {
+		return nil
+	}
+	if driverType != PostgresDriver {
+		return fmt.Errorf("tenant %s: schema-per-tenant is only supported on Postgres", tenant)
+	}
+	schema, err := TenantSchema(tenant)
+	if err != nil {
+		return err
+	}
+	_, err = exec.ExecContext(ctx, "SELECT set_config('search_path', $1, true)", schema+", public")
+	if err != nil {
+		return fmt.Errorf("set tenant %s search_path: %w", tenant, err)
+	}
+	return nil
+}
+
+// Tenants returns the tenants having a schema, sorted by name
+func (d *DB) Tenants(ctx context.Context) ([]string, error) {
+	if d.DriverType() != PostgresDriver {
+		return nil, errors.New("schema-per-tenant is only supported on Postgres")
+	}
+	rows, err := d.QueryContext(ctx, "SELECT schema_name FROM information_schema.schemata WHERE starts_with(schema_name, $1) ORDER BY schema_name", TenantSchemaPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("list tenants: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var schema string
+		err = rows.Scan(&schema)
+		if err != nil {
+			return nil, fmt.Errorf("list tenants: %w", err)
+		}
+		tenants = append(tenants, strings.TrimPrefix(schema, TenantSchemaPrefix))
+	}
+	return tenants, rows.Err()
+}
+
+// CreateTenant creates the schema of tenant if it doesn't exist yet, then runs the tenant migrations in it
+func (d *DB) CreateTenant(ctx context.Context, tenant string) error {
+	schema, err := TenantSchema(tenant)
+	if err != nil {
+		return err
+	}
+	if d.DriverType() != PostgresDriver {
+		return errors.New("schema-per-tenant is only supported on Postgres")
+	}
+
+	_, err = d.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+PostgresDriver.Quote(schema))
+	if err != nil {
+		return fmt.Errorf("create tenant %s schema: %w", tenant, err)
+	}
+	return d.migrateTenant(ctx, tenant)
+}
+
+// MigrateTenants runs the tenant migrations in every tenant schema, one tenant at a time
+// Each schema has its own goose version table, while the registered Go migrations only apply to the main schema
+func (d *DB) MigrateTenants(ctx context.Context) error {
+	tenants, err := d.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err = d.migrateTenant(ctx, tenant)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTenant runs the tenant migrations through a short-lived pool whose search_path is the tenant schema
+func (d *DB) migrateTenant(ctx context.Context, tenant string) error {
+	conf, err := tenantConfig(d.conf, tenant)
+	if err != nil {
+		return err
+	}
+	if d.fsys == nil {
+		return errors.New("can't run tenant migrations: no file system was passed to Open()")
+	}
+
+	sqlDB, err := sql.Open(conf.Driver, fromDBConfToConnectionString(conf))
+	if err != nil {
+		return fmt.Errorf("tenant %s: %w", tenant, err)
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(2)
+	err = sqlDB.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("tenant %s: %w", tenant, err)
+	}
+
+	tenantDB := &DB{DB: sqlDB, conf: conf, fsys: d.fsys}
+	err = tenantDB.up(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate tenant %s: %w", tenant, err)
+	}
+	return nil
+}
+
+// tenantConfig returns the configuration of the pool used to migrate tenant
+func tenantConfig(conf DBConfig, tenant string) (DBConfig, error) {
+	schema, err := TenantSchema(tenant)
+	if err != nil {
+		return conf, err
+	}
+	if normalizeDriver(conf.Driver) != PostgresDriver {
+		return conf, errors.New("schema-per-tenant is only supported on Postgres")
+	}
+	if conf.DSN != "" {
+		return conf, errors.New("tenant migrations can't be used along with a raw DSN")
+	}
+	conf.Schema = schema + ",public"
+	if conf.Migrations.TenantPath != "" {
+		conf.Migrations.Path = conf.Migrations.TenantPath
+	}
+	return conf, nil
+}
@@ -0,0 +1,82 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+func TestTenantSchema(t *testing.T) {
+	schema, err := TenantSchema("acme_2")
+	require.NoError(t, err)
+	assert.Equal(t, "tenant_acme_2", schema)
+
+	for _, invalid := range []string{"", "Acme", "acme; DROP TABLE users", "acme-corp"} {
+		_, err = TenantSchema(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTenantSearchPath(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, TenantFromContext(ctx))
+
+	exec := &recordingExecutor{}
+	require.NoError(t, setTenantSearchPath(ctx, exec, PostgresDriver, ""))
+	assert.Empty(t, exec.queries)
+
+	ctx = WithTenant(ctx, "acme")
+	require.NoError(t, setTenantSearchPath(ctx, exec, PostgresDriver, TenantFromContext(ctx)))
+	assert.Equal(t, [][]any{{"SELECT set_config('search_path', $1, true)", "tenant_acme, public"}}, exec.queries)
+
+	assert.ErrorContains(t, setTenantSearchPath(ctx, exec, MSSQLDriver, "acme"), "only supported on Postgres")
+	assert.ErrorContains(t, setTenantSearchPath(ctx, exec, PostgresDriver, "ACME"), "invalid tenant name")
+}
+
+func TestTenantSearchPathHook(t *testing.T) {
+	previous := txHooks
+	defer func() { txHooks = previous }()
+
+	sqlDB := testutil.OpenSQLite(t, itemsTable)
+	txFunc := func(ctx context.Context, tx *sql.Tx) error { return nil }
+
+	// Without EnableTenantSearchPath the tenant is ignored
+	require.NoError(t, Transaction(WithTenant(context.Background(), "acme"), sqlDB, txFunc))
+
+	RegisterTxHook(tenantSearchPathHook)
+	require.NoError(t, Transaction(context.Background(), sqlDB, txFunc))
+	err := Transaction(WithTenant(context.Background(), "acme"), sqlDB, txFunc)
+	assert.ErrorContains(t, err, "only supported on Postgres")
+}
+
+func TestTenantsPostgresOnly(t *testing.T) {
+	db := &DB{DB: testutil.OpenSQLite(t, itemsTable), conf: DBConfig{Driver: "sqlite"}}
+
+	_, err := db.Tenants(context.Background())
+	assert.ErrorContains(t, err, "only supported on Postgres")
+	assert.ErrorContains(t, db.MigrateTenants(context.Background()), "only supported on Postgres")
+}
+
+func TestTenantConfig(t *testing.T) {
+	conf := DBConfig{Driver: "postgres", Server: "localhost", DB: "app", Schema: "public"}
+	conf.Migrations.Path = "sql"
+	conf.Migrations.TenantPath = "sql/tenant"
+
+	tenantConf, err := tenantConfig(conf, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, "tenant_acme,public", tenantConf.Schema)
+	assert.Equal(t, "sql/tenant", tenantConf.Migrations.Path)
+	assert.Equal(t, "tenant_acme.goose_db_version", (&DB{conf: tenantConf}).migrationsTable())
+
+	conf.DSN = "host=localhost"
+	_, err = tenantConfig(conf, "acme")
+	assert.ErrorContains(t, err, "raw DSN")
+
+	conf.Driver = "sqlserver"
+	_, err = tenantConfig(conf, "acme")
+	assert.ErrorContains(t, err, "only supported on Postgres")
+}
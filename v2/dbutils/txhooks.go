@@ -0,0 +1,81 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// TxHook is run by Transaction right after beginning a transaction, before running the transaction function
+// driver is the driver of the executor passed to Transaction, empty if unknown
+// Returning an error rolls the transaction back
+type TxHook func(ctx context.Context, tx *sql.Tx, driver DriverType) error
+
+var (
+	txHooks   []TxHook
+	txHooksMu sync.RWMutex
+)
+
+// RegisterTxHook registers a hook run for every transaction begun by Transaction and TransactionResult
+// Hooks run in registration order, and they're not run for the transactions reused from the context
+// It's meant to be called on startup, i.e. from an init() function
+func RegisterTxHook(hook TxHook) {
+	txHooksMu.Lock()
+	defer txHooksMu.Unlock()
+	txHooks = append(txHooks, hook)
+}
+
+func runTxHooks(ctx context.Context, tx *sql.Tx, driver DriverType) error {
+	txHooksMu.RLock()
+	hooks := slices.Clone(txHooks)
+	txHooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		err := hook(ctx, tx, driver)
+		if err != nil {
+			return fmt.Errorf("transaction hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetTxVariables sets variables for the current transaction, so that i.e. row-level security policies can read them
+// On Postgres they're set with set_config(key, value, true), and read with current_setting('app.user', true)
+// On MSSQL they're set with sp_set_session_context, and read with SESSION_CONTEXT(N'app.user'): empty values are set to NULL
+// Note that on MSSQL they last for the whole connection session, so they must be set again by every transaction
+// On SQLite this is a no-op, while unknown drivers return an error
+// driver is the driver of the DB the transaction belongs to, i.e. the one passed to a TxHook
+func SetTxVariables(ctx context.Context, tx *sql.Tx, driver DriverType, vars map[string]string) error {
+	return setTxVariables(ctx, tx, driver, vars)
+}
+
+func setTxVariables(ctx context.Context, exec lockExecutor, driverType DriverType, vars map[string]string) error {
+	if len(vars) == 0 {
+		return nil
+	}
+	switch driverType {
+	case SQLiteDriver:
+		// SQLite has no session variables
+		return nil
+	case MSSQLDriver, PostgresDriver:
+	default:
+		return fmt.Errorf("transaction variables: unsupported driver %q", driverType)
+	}
+	for _, key := range slices.Sorted(maps.Keys(vars)) {
+		var err error
+		switch driverType {
+		case MSSQLDriver:
+			value := sql.NullString{String: vars[key], Valid: vars[key] != ""}
+			_, err = exec.ExecContext(ctx, "EXEC sp_set_session_context @key = @p1, @value = @p2", key, value)
+		default:
+			_, err = exec.ExecContext(ctx, "SELECT set_config($1, $2, true)", key, vars[key])
+		}
+		if err != nil {
+			return fmt.Errorf("set %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+)
+
+// recordingExecutor records the statements it's asked to run
+type recordingExecutor struct {
+	queries [][]any
+}
+
+func (r *recordingExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.queries = append(r.queries, append([]any{query}, args...))
+	return nil, nil
+}
+
+func (r *recordingExecutor) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+// itemsTable is the table used by the tests running queries
+const itemsTable = "CREATE TABLE items (code TEXT PRIMARY KEY, name TEXT NOT NULL, qty INTEGER NOT NULL)"
+
+func TestTxHooks(t *testing.T) {
+	previous := txHooks
+	defer func() { txHooks = previous }()
+
+	sqlDB := testutil.OpenSQLite(t, itemsTable)
+	calls := 0
+	RegisterTxHook(func(ctx context.Context, tx *sql.Tx, driver DriverType) error {
+		calls++
+		assert.Same(t, tx, Tx(ctx))
+		assert.Equal(t, SQLiteDriver, driver)
+		_, err := tx.ExecContext(ctx, "INSERT INTO items (code, name, qty) VALUES (?, 'hook', 0)", fmt.Sprint(calls))
+		return err
+	})
+
+	err := Transaction(context.Background(), sqlDB, func(ctx context.Context, tx *sql.Tx) error {
+		// Reusing the transaction from the context doesn't run the hooks again
+		return Transaction(ctx, sqlDB, func(ctx context.Context, tx *sql.Tx) error { return nil })
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	// A failing hook rolls the transaction back, without running the transaction function
+	RegisterTxHook(func(ctx context.Context, tx *sql.Tx, _ DriverType) error {
+		return errors.New("boom")
+	})
+	err = Transaction(context.Background(), sqlDB, func(ctx context.Context, tx *sql.Tx) error {
+		t.Fatal("transaction function called")
+		return nil
+	})
+	assert.ErrorContains(t, err, "transaction hook: boom")
+
+	var count int
+	require.NoError(t, sqlDB.QueryRow("SELECT COUNT(*) FROM items").Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestSetTxVariables(t *testing.T) {
+	vars := map[string]string{"app.user": "john", "app.tenant": ""}
+
+	exec := &recordingExecutor{}
+	require.NoError(t, setTxVariables(context.Background(), exec, PostgresDriver, vars))
+	assert.Equal(t, [][]any{
+		{"SELECT set_config($1, $2, true)", "app.tenant", ""},
+		{"SELECT set_config($1, $2, true)", "app.user", "john"},
+	}, exec.queries)
+
+	exec = &recordingExecutor{}
+	require.NoError(t, setTxVariables(context.Background(), exec, MSSQLDriver, vars))
+	assert.Equal(t, [][]any{
+		{"EXEC sp_set_session_context @key = @p1, @value = @p2", "app.tenant", sql.NullString{}},
+		{"EXEC sp_set_session_context @key = @p1, @value = @p2", "app.user", sql.NullString{String: "john", Valid: true}},
+	}, exec.queries)
+
+	exec = &recordingExecutor{}
+	require.NoError(t, setTxVariables(context.Background(), exec, SQLiteDriver, vars))
+	assert.Empty(t, exec.queries)
+
+	// Unknown drivers are never sent the SQL of another one
+	assert.ErrorContains(t, setTxVariables(context.Background(), exec, "", vars), "unsupported driver")
+	assert.Empty(t, exec.queries)
+}
@@ -0,0 +1,97 @@
+package humautils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// ETagHeader is embedded in the output of GET operations to return the version of the resource, i.e.:
+//
+//	type GetUserOutput struct {
+//		humautils.ETagHeader
+//		Body User
+//	}
+type ETagHeader struct {
+	ETag string `header:"ETag" doc:"The version of the resource, to be sent back in the If-Match header of updates"`
+}
+
+// IfMatchParams is embedded in the input of PUT and PATCH operations to enforce optimistic concurrency:
+// the update must carry the ETag returned by the GET operation, and it's rejected with a 412 when the resource has changed
+// Updates without If-Match are rejected with a 428 Precondition Required
+type IfMatchParams struct {
+	IfMatch []string `header:"If-Match" doc:"Required: the ETag of the resource being updated, as returned by the GET operation, or * to match any version"`
+}
+
+// preconditionRequiredError is a validation error reported with a 428 status code
+type preconditionRequiredError struct {
+	*huma.ErrorDetail
+}
+
+func (e preconditionRequiredError) GetStatus() int {
+	return http.StatusPreconditionRequired
+}
+
+// Resolve rejects the requests without If-Match with a 428 Precondition Required, rather than the 422 of required headers
+func (p *IfMatchParams) Resolve(ctx huma.Context) []error {
+	if len(p.IfMatch) > 0 {
+		return nil
+	}
+	return []error{preconditionRequiredError{&huma.ErrorDetail{
+		Message:  "the If-Match header is required: fetch the resource and send back its ETag",
+		Location: "header.If-Match",
+	}}}
+}
+
+// ETag returns the quoted, opaque ETag of a resource version, i.e. a version number or an updated_at timestamp
+func ETag(version any) string {
+	if t, ok := version.(time.Time); ok {
+		// Ignore the location and the monotonic clock, so that the same instant always gets the same ETag
+		version = t.UnixNano()
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprint(version)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NewETagHeader returns the ETagHeader of a resource version
+func NewETagHeader(version any) ETagHeader {
+	return ETagHeader{ETag: ETag(version)}
+}
+
+// Check returns a 412 Precondition Failed error unless the If-Match header matches the current version of the resource
+// ETags are compared with the strong comparison of RFC 7232, so weak ones (W/"...") never match
+// The update itself should then be version-checked as well, i.e. with bob_helpers.Repository.UpdateVersioned,
+// to catch the changes made in the meantime
+func (p *IfMatchParams) Check(version any) error {
+	etag := ETag(version)
+	for _, header := range p.IfMatch {
+		for _, match := range strings.Split(header, ",") {
+			match = strings.TrimSpace(match)
+			if match == "*" || match == etag {
+				return nil
+			}
+		}
+	}
+	return huma.Error412PreconditionFailed("the resource was modified: fetch it again and retry", &huma.ErrorDetail{
+		Message:  "If-Match precondition failed, the current ETag is " + etag,
+		Location: "header.If-Match",
+		Value:    p.IfMatch,
+	})
+}
+
+// ConflictToPreconditionFailed maps the errors marking a failed precondition, i.e. bob_helpers.ErrConflict,
+// to a 412 Precondition Failed error, returning other errors as they are
+// RegisterEndpoint already does this for every handler
+func ConflictToPreconditionFailed(err error) error {
+	var precondition interface{ PreconditionFailed() bool }
+	if errors.As(err, &precondition) && precondition.PreconditionFailed() {
+		return huma.Error412PreconditionFailed("the resource was modified: fetch it again and retry")
+	}
+	return err
+}
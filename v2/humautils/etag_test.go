@@ -0,0 +1,92 @@
+package humautils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	assert.Equal(t, ETag(1), ETag(int64(1)))
+	assert.NotEqual(t, ETag(1), ETag(2))
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, ETag("v1"))
+
+	updatedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, ETag(updatedAt), ETag(updatedAt.In(time.FixedZone("CET", 3600))))
+	assert.NotEqual(t, ETag(updatedAt), ETag(updatedAt.Add(time.Microsecond)))
+}
+
+// conflictError mimics bob_helpers.ErrConflict, which humautils doesn't import
+type conflictError struct{}
+
+func (conflictError) Error() string            { return "conflict" }
+func (conflictError) PreconditionFailed() bool { return true }
+
+func TestIfMatch(t *testing.T) {
+	_, api := humatest.New(t)
+	version := 1
+	// conflict simulates a concurrent update between the If-Match check and the update itself
+	conflict := false
+
+	type getOutput struct {
+		ETagHeader
+		Body struct {
+			Version int `json:"version"`
+		}
+	}
+	type putInput struct {
+		IfMatchParams
+	}
+
+	RegisterEndpoint(api, "items", huma.Operation{OperationID: "get-item", Method: http.MethodGet, Path: "/item"}, func(ctx context.Context, input *struct{}) (*getOutput, error) {
+		output := &getOutput{ETagHeader: NewETagHeader(version)}
+		output.Body.Version = version
+		return output, nil
+	})
+	RegisterEndpoint(api, "items", huma.Operation{OperationID: "put-item", Method: http.MethodPut, Path: "/item"}, func(ctx context.Context, input *putInput) (*struct{}, error) {
+		err := input.Check(version)
+		if err != nil {
+			return nil, err
+		}
+		if conflict {
+			return nil, fmt.Errorf("update items 1: %w", conflictError{})
+		}
+		version++
+		return nil, nil
+	})
+
+	resp := api.Get("/item")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	etag := resp.Header().Get("ETag")
+	assert.Equal(t, ETag(1), etag)
+
+	resp = api.Put("/item")
+	assert.Equal(t, http.StatusPreconditionRequired, resp.Code, "If-Match is required")
+
+	resp = api.Put("/item", "If-Match: "+ETag(42))
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+	// If-Match uses the strong comparison
+	resp = api.Put("/item", "If-Match: W/"+etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+	resp = api.Put("/item", "If-Match: "+ETag(42)+", "+etag)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	// The version changed in the meantime
+	resp = api.Put("/item", "If-Match: "+etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+	resp = api.Put("/item", "If-Match: *")
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	conflict = true
+	resp = api.Put("/item", "If-Match: "+ETag(version))
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+}
@@ -74,6 +74,7 @@ func RegisterEndpoint[I, O any](api huma.API, resource string, op huma.Operation
 
 	huma.Register(api, op, func(ctx context.Context, input *I) (*O, error) {
 		output, err := handler(ctx, input)
+		err = ConflictToPreconditionFailed(err)
 		if err != nil {
 			if _, ok := err.(huma.StatusError); !ok {
 				slog.Error("Unexpected error",
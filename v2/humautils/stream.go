@@ -0,0 +1,118 @@
+package humautils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"iter"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// streamFlushEvery is the number of rows after which the streamed response is flushed to the client
+const streamFlushEvery = 100
+
+// StreamCSV returns a response streaming rows as a CSV attachment named filename, without buffering them
+// header holds the column names, while record maps each row to its fields, in the same order
+// If rows fails before yielding anything, a 500 is returned: afterwards the status is already sent,
+// so the error is logged and the response is truncated
+func StreamCSV[T any](filename string, header []string, rows iter.Seq2[T, error], record func(T) []string) *huma.StreamResponse {
+	return &huma.StreamResponse{
+		Body: func(ctx huma.Context) {
+			var w *csv.Writer
+			start := func() {
+				ctx.SetHeader("Content-Type", "text/csv; charset=utf-8")
+				ctx.SetHeader("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+				w = csv.NewWriter(ctx.BodyWriter())
+				_ = w.Write(header)
+			}
+
+			streamRows(ctx, rows, start, func(row T) error {
+				return w.Write(record(row))
+			}, func() error {
+				w.Flush()
+				return w.Error()
+			})
+		},
+	}
+}
+
+// StreamNDJSON returns a response streaming rows as newline-delimited JSON, one object per line, without buffering them
+// Errors are handled like in StreamCSV
+func StreamNDJSON[T any](rows iter.Seq2[T, error]) *huma.StreamResponse {
+	return &huma.StreamResponse{
+		Body: func(ctx huma.Context) {
+			var enc *json.Encoder
+			start := func() {
+				ctx.SetHeader("Content-Type", "application/x-ndjson")
+				enc = json.NewEncoder(ctx.BodyWriter())
+			}
+
+			streamRows(ctx, rows, start, func(row T) error {
+				return enc.Encode(row)
+			}, func() error {
+				return nil
+			})
+		},
+	}
+}
+
+// streamRows writes rows with write, calling start before the first one (or at the end, if there are none)
+// flush is called every streamFlushEvery rows and at the end, before flushing the response itself
+func streamRows[T any](ctx huma.Context, rows iter.Seq2[T, error], start func(), write func(T) error, flush func() error) {
+	started := false
+	count := 0
+	for row, err := range rows {
+		if err != nil {
+			if !started {
+				writeStreamError(ctx, err)
+				return
+			}
+			slog.ErrorContext(ctx.Context(), "streaming response truncated", "rows", count, "err", err)
+			break
+		}
+		if !started {
+			start()
+			started = true
+		}
+		err = write(row)
+		if err != nil {
+			// The client is gone: there's no one left to write to
+			slog.WarnContext(ctx.Context(), "streaming response interrupted", "rows", count, "err", err)
+			return
+		}
+		count++
+		if count%streamFlushEvery == 0 {
+			flushStream(ctx, flush)
+		}
+	}
+	if !started {
+		start()
+	}
+	flushStream(ctx, flush)
+}
+
+func flushStream(ctx huma.Context, flush func() error) {
+	if err := flush(); err != nil {
+		slog.WarnContext(ctx.Context(), "streaming response interrupted", "err", err)
+		return
+	}
+	if f, ok := ctx.BodyWriter().(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeStreamError reports an error occurred before anything was streamed as a problem+json 500
+func writeStreamError(ctx huma.Context, err error) {
+	slog.ErrorContext(ctx.Context(), "Unexpected error", "status", http.StatusInternalServerError, "error", err)
+	ctx.SetHeader("Content-Type", "application/problem+json")
+	ctx.SetStatus(http.StatusInternalServerError)
+	body, _ := json.Marshal(huma.ErrorModel{
+		Status: http.StatusInternalServerError,
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Detail: "unexpected error occurred",
+	})
+	_, _ = ctx.BodyWriter().Write(body)
+}
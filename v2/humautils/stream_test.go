@@ -0,0 +1,78 @@
+package humautils
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/assert"
+)
+
+type exportRow struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// exportRows yields the given rows, then err if not nil
+func exportRows(err error, rows ...exportRow) iter.Seq2[exportRow, error] {
+	return func(yield func(exportRow, error) bool) {
+		for _, r := range rows {
+			if !yield(r, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield(exportRow{}, err)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	_, api := humatest.New(t)
+	var failWith error
+	rows := []exportRow{{1, "John"}, {2, "Jane, Jr."}}
+
+	huma.Get(api, "/export.csv", func(ctx context.Context, input *struct{}) (*huma.StreamResponse, error) {
+		return StreamCSV("export.csv", []string{"id", "name"}, exportRows(failWith, rows...), func(r exportRow) []string {
+			return []string{strconv.Itoa(r.ID), r.Name}
+		}), nil
+	})
+	huma.Get(api, "/export.ndjson", func(ctx context.Context, input *struct{}) (*huma.StreamResponse, error) {
+		return StreamNDJSON(exportRows(failWith, rows...)), nil
+	})
+
+	resp := api.Get("/export.csv")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=export.csv", resp.Header().Get("Content-Disposition"))
+	assert.Equal(t, "id,name\n1,John\n2,\"Jane, Jr.\"\n", resp.Body.String())
+
+	resp = api.Get("/export.ndjson")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"id\":1,\"name\":\"John\"}\n{\"id\":2,\"name\":\"Jane, Jr.\"}\n", resp.Body.String())
+
+	// Errors after the first row truncate the response
+	failWith = errors.New("boom")
+	resp = api.Get("/export.csv")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "id,name\n1,John\n2,\"Jane, Jr.\"\n", resp.Body.String())
+
+	// Errors before the first row are reported as such
+	rows = nil
+	resp = api.Get("/export.ndjson")
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Equal(t, "application/problem+json", resp.Header().Get("Content-Type"))
+	assert.NotContains(t, resp.Body.String(), "boom")
+
+	// No rows at all still produce the CSV header
+	failWith = nil
+	resp = api.Get("/export.csv")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "id,name\n", resp.Body.String())
+}
@@ -0,0 +1,100 @@
+package testutil
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"time"
+
+	"github.com/aarondl/opt/omit"
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/dialect"
+	"github.com/stephenafamo/bob/dialect/psql/um"
+	"github.com/stephenafamo/bob/expr"
+)
+
+// ItemsTable creates the SQLite table of Item, to be passed to OpenSQLite
+const ItemsTable = `CREATE TABLE items (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMP,
+	created_by TEXT,
+	updated_at TIMESTAMP,
+	deleted_at TIMESTAMP
+)`
+
+// Item and ItemSetter mimic the models generated by bobgen, with optimistic locking and audit columns
+type Item struct {
+	ID        int                 `db:"id,pk"`
+	Name      string              `db:"name"`
+	Version   int                 `db:"version"`
+	CreatedAt sql.Null[time.Time] `db:"created_at"`
+	CreatedBy sql.Null[string]    `db:"created_by"`
+	UpdatedAt sql.Null[time.Time] `db:"updated_at"`
+	DeletedAt sql.Null[time.Time] `db:"deleted_at"`
+}
+
+// ItemSetter only writes the columns it sets, so that the others get their default value
+type ItemSetter struct {
+	ID        omit.Val[int]       `db:"id,pk"`
+	Name      omit.Val[string]    `db:"name"`
+	Version   omit.Val[int]       `db:"version"`
+	CreatedAt omit.Val[time.Time] `db:"created_at"`
+	CreatedBy *string             `db:"created_by"`
+	UpdatedAt omit.Val[time.Time] `db:"updated_at"`
+}
+
+// values returns the set columns along with their values
+func (s ItemSetter) values() ([]string, []any) {
+	var columns []string
+	var values []any
+	add := func(column string, set bool, value any) {
+		if set {
+			columns = append(columns, column)
+			values = append(values, value)
+		}
+	}
+	add("id", s.ID.IsValue(), s.ID)
+	add("name", s.Name.IsValue(), s.Name)
+	add("version", s.Version.IsValue(), s.Version)
+	add("created_at", s.CreatedAt.IsValue(), s.CreatedAt)
+	add("created_by", s.CreatedBy != nil, s.CreatedBy)
+	add("updated_at", s.UpdatedAt.IsValue(), s.UpdatedAt)
+	return columns, values
+}
+
+func (s ItemSetter) SetColumns() []string {
+	columns, _ := s.values()
+	return columns
+}
+
+func (s *ItemSetter) Apply(q *dialect.InsertQuery) {
+	columns, values := s.values()
+	q.Columns = columns
+	q.AppendValues(bob.ExpressionFunc(func(ctx context.Context, w io.Writer, d bob.Dialect, start int) ([]any, error) {
+		args := make([]bob.Expression, len(values))
+		for i, v := range values {
+			args[i] = psql.Arg(v)
+		}
+		return bob.ExpressSlice(ctx, w, d, start, args, "", ", ", "")
+	}))
+}
+
+func (s ItemSetter) UpdateMod() bob.Mod[*dialect.UpdateQuery] {
+	return bob.ModFunc[*dialect.UpdateQuery](func(q *dialect.UpdateQuery) {
+		columns, values := s.values()
+		for i, column := range columns {
+			if column != "id" {
+				um.SetCol(column).ToArg(values[i]).Apply(q)
+			}
+		}
+	})
+}
+
+// NewItemsTable returns a new table of Item: each test gets its own, so that the hooks registered by one don't leak to the others
+func NewItemsTable() *psql.Table[*Item, []*Item, *ItemSetter, expr.ColumnsExpr] {
+	return psql.NewTable[*Item, *ItemSetter]("", "items",
+		expr.NewColumnsExpr("id", "name", "version", "created_at", "created_by", "updated_at", "deleted_at").WithParent("items"))
+}
@@ -0,0 +1,48 @@
+// Package testutil holds the fixtures shared by the tests of the module
+package testutil
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite opens a SQLite DB in a temporary directory, closed when the test ends, and runs the given statements in it
+func OpenSQLite(t *testing.T, statements ...string) *sql.DB {
+	t.Helper()
+	sqlDB, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for _, statement := range statements {
+		_, err = sqlDB.Exec(statement)
+		require.NoError(t, err)
+	}
+	return sqlDB
+}
+
+// FailingDriverName is the name FailingDriver is registered with, to be passed to sql.Open
+const FailingDriverName = "failing"
+
+// FailingDriver is a database/sql driver which never connects, counting the connection attempts
+type FailingDriver struct {
+	Attempts atomic.Int32
+}
+
+func (d *FailingDriver) Open(name string) (driver.Conn, error) {
+	d.Attempts.Add(1)
+	return nil, errors.New("connection refused")
+}
+
+// Failing is the FailingDriver registered as FailingDriverName
+var Failing = &FailingDriver{}
+
+func init() {
+	sql.Register(FailingDriverName, Failing)
+}
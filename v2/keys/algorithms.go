@@ -0,0 +1,114 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultAlgorithms are the algorithms accepted when JWT.Algorithms is empty, along with the one of the signing key
+var DefaultAlgorithms = []string{"RS256", "RS384", "RS512"}
+
+// algorithmFor returns the default signing algorithm of a key
+func algorithmFor(key any) (string, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		return ecdsaAlgorithm(key.Curve)
+	case *ecdsa.PublicKey:
+		return ecdsaAlgorithm(key.Curve)
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return "EdDSA", nil
+	case []byte:
+		return "HS256", nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func ecdsaAlgorithm(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return "ES256", nil
+	case elliptic.P384():
+		return "ES384", nil
+	case elliptic.P521():
+		return "ES512", nil
+	default:
+		return "", fmt.Errorf("unsupported curve %s", curve.Params().Name)
+	}
+}
+
+// isHMAC reports whether alg is a symmetric algorithm, whose verification key is the signing secret
+func isHMAC(alg string) bool {
+	return strings.HasPrefix(alg, "HS")
+}
+
+// keyMatchesAlgorithm reports whether key can verify a token signed with alg, so that a key is never used with
+// an algorithm of another family (i.e. an RSA public key as an HMAC secret)
+func keyMatchesAlgorithm(key crypto.PublicKey, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	default:
+		return false
+	}
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded private key: RSA (PKCS #1 or PKCS #8), ECDSA (SEC 1 or PKCS #8) or Ed25519 (PKCS #8)
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// ParsePublicKeyPEM parses a PEM encoded public key (PKIX or PKCS #1) or certificate: RSA, ECDSA or Ed25519
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate: %w", err)
+		}
+		return cert.PublicKey, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	return key, nil
+}
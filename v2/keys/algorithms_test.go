@@ -0,0 +1,141 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"testing/fstest"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pemFS(t *testing.T, key crypto.Signer) fstest.MapFS {
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	return fstest.MapFS{
+		"private.pem": {Data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private})},
+		"public.pem":  {Data: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})},
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey := newRSAKey(t)
+
+	for _, test := range []struct {
+		alg       string
+		key       crypto.Signer
+		algorithm string
+	}{
+		{alg: "RS256", key: rsaKey},
+		{alg: "PS256", key: rsaKey, algorithm: "PS256"},
+		{alg: "ES256", key: ecKey},
+		{alg: "ES384", key: ec384Key},
+		{alg: "EdDSA", key: edKey},
+	} {
+		t.Run(test.alg, func(t *testing.T) {
+			FS := pemFS(t, test.key)
+			signer := &JWT{Algorithm: test.algorithm}
+			require.NoError(t, signer.ReadPrivateKey(FS, "private.pem"))
+			verifier := &JWT{Algorithms: []string{test.alg}}
+			require.NoError(t, verifier.ReadPublicKey(FS, "public.pem"))
+
+			token, err := signer.TokenFromClaims(Claims{Username: "john"})
+			require.NoError(t, err)
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, test.alg, parsed.Method.Alg())
+
+			claims, err := verifier.ParseAndValidateToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, "john", claims.Username)
+
+			// The signer accepts its own tokens too
+			_, err = signer.ParseAndValidateToken(token)
+			assert.NoError(t, err)
+
+			// Algorithms outside the allow-list are rejected
+			verifier.Algorithms = []string{"HS256"}
+			_, err = verifier.ParseAndValidateToken(token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+
+			jwk, err := NewJWK("kid", test.key.Public())
+			require.NoError(t, err)
+			key, err := jwk.PublicKey()
+			require.NoError(t, err)
+			assert.True(t, key.(interface{ Equal(crypto.PublicKey) bool }).Equal(test.key.Public()))
+		})
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	j := &JWT{SigningKey: []byte("secret")}
+	token, err := j.TokenFromClaims(Claims{Username: "john"})
+	require.NoError(t, err)
+	claims, err := j.ParseAndValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "john", claims.Username)
+
+	_, err = (&JWT{SigningKey: []byte("other")}).ParseAndValidateToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	verifier := &JWT{PublicKey: &rsaKey.PublicKey}
+
+	// An HS256 token signed with the public key as the secret must not be accepted
+	public, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	forged := &JWT{SigningKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})}
+	token, err := forged.TokenFromClaims(Claims{Username: "john"})
+	require.NoError(t, err)
+	_, err = verifier.ParseAndValidateToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Even when allowed, an algorithm must match the key type
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	token, err = (&JWT{SigningKey: ecKey}).TokenFromClaims(Claims{Username: "john"})
+	require.NoError(t, err)
+	verifier.Algorithms = []string{"RS256", "ES256"}
+	_, err = verifier.ParseAndValidateToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	_, err := ParsePrivateKeyPEM([]byte("not a key"))
+	assert.Error(t, err)
+	_, err = ParsePublicKeyPEM([]byte("not a key"))
+	assert.Error(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}))
+	require.NoError(t, err)
+	assert.True(t, ecKey.Equal(key))
+
+	rsaKey := newRSAKey(t)
+	key, err = ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	require.NoError(t, err)
+	assert.True(t, rsaKey.Equal(key))
+	public, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)}))
+	require.NoError(t, err)
+	assert.True(t, rsaKey.PublicKey.Equal(public))
+}
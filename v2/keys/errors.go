@@ -0,0 +1,41 @@
+package keys
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// ErrorWriter writes the error responses of RequestJWTWithConfig: the WWW-Authenticate header, if needed, is already set
+type ErrorWriter func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// DefaultErrorWriter writes the errors as RFC 9457 problem+json bodies, like Huma does
+// The details of internal server errors are logged rather than sent to the client
+func DefaultErrorWriter(w http.ResponseWriter, r *http.Request, status int, err error) {
+	detail := err.Error()
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "authentication failed", "path", r.URL.Path, "method", r.Method, "err", err)
+		detail = "unable to authenticate the request"
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&huma.ErrorModel{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// bearerChallenge returns the RFC 6750 WWW-Authenticate header for an error code, or a bare challenge if code is empty
+func bearerChallenge(code string, err error) string {
+	if code == "" {
+		return "Bearer"
+	}
+	// Quotes and backslashes aren't allowed in error_description
+	description := strings.NewReplacer(`"`, "'", `\`, "/").Replace(err.Error())
+	return `Bearer error="` + code + `", error_description="` + description + `"`
+}
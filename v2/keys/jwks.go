@@ -0,0 +1,426 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// JWK is a JSON Web Key (RFC 7517), as found in a JWKS document
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP (Ed25519) keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document, as served by the jwks_uri of an authorization server
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKSConfig configures StartJWKSRefresh
+type JWKSConfig struct {
+	// URL of the JWKS document
+	URL string
+	// RefreshInterval is how often the JWKS is fetched (1 hour if zero)
+	RefreshInterval time.Duration
+	// MinRefreshInterval is the minimum time between two fetches triggered by tokens with an unknown kid (1 minute if zero),
+	// so that forged tokens can't be used to flood the JWKS endpoint
+	MinRefreshInterval time.Duration
+	// Client is used to fetch the JWKS (a client with a 5 seconds timeout if nil)
+	Client *http.Client
+}
+
+// keySet holds the verification keys of a JWT, by kid
+type keySet struct {
+	mu sync.RWMutex
+	// local keys are added with AddPublicKey, and are published by JWKS
+	local map[string]crypto.PublicKey
+	// remote keys are fetched from a JWKS URL, replacing the previous ones on each refresh
+	remote map[string]crypto.PublicKey
+
+	// refreshMu serializes the JWKS fetches
+	refreshMu   sync.Mutex
+	config      *JWKSConfig
+	lastRefresh time.Time
+}
+
+// AddPublicKey adds a verification key for the tokens with the given kid, i.e. the previous key during a key rotation
+// The added keys are published by JWKS along with the signing key
+func (j *JWT) AddPublicKey(kid string, key crypto.PublicKey) {
+	j.keys.mu.Lock()
+	defer j.keys.mu.Unlock()
+	if j.keys.local == nil {
+		j.keys.local = map[string]crypto.PublicKey{}
+	}
+	j.keys.local[kid] = key
+}
+
+// StartJWKSRefresh launches a goroutine that fetches the verification keys from a JWKS URL, refreshing them periodically until ctx is done
+// Tokens signed with an unknown kid also trigger a refresh, at most once per config.MinRefreshInterval
+func (j *JWT) StartJWKSRefresh(ctx context.Context, config JWKSConfig) {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Hour
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = time.Minute
+	}
+	j.keys.refreshMu.Lock()
+	j.keys.config = &config
+	j.keys.refreshMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(config.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			err := j.refreshJWKS(ctx)
+			if err != nil {
+				slog.Error("StartJWKSRefresh: unable to read JWKS", "url", config.URL, "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ReadJWKSFromURL reads and stores the verification keys of a JWKS URL, replacing the previously fetched ones
+func (j *JWT) ReadJWKSFromURL(ctx context.Context, url string) error {
+	return j.readJWKS(ctx, &http.Client{Timeout: 5 * time.Second}, url)
+}
+
+// refreshJWKS fetches the configured JWKS URL
+func (j *JWT) refreshJWKS(ctx context.Context) error {
+	j.keys.refreshMu.Lock()
+	defer j.keys.refreshMu.Unlock()
+	return j.fetchJWKS(ctx)
+}
+
+// fetchJWKS fetches the configured JWKS URL: refreshMu must be held
+func (j *JWT) fetchJWKS(ctx context.Context) error {
+	client := j.keys.config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	j.keys.lastRefresh = time.Now()
+	return j.readJWKS(ctx, client, j.keys.config.URL)
+}
+
+// refreshForKid refreshes the configured JWKS looking for an unknown kid, unless it was refreshed too recently
+// It runs on the request path, bound by the request ctx: it fails fast rather than waiting for a refresh already in progress
+func (j *JWT) refreshForKid(ctx context.Context, kid string) {
+	if !j.keys.refreshMu.TryLock() {
+		return
+	}
+	defer j.keys.refreshMu.Unlock()
+	config := j.keys.config
+	if config == nil || time.Since(j.keys.lastRefresh) < config.MinRefreshInterval {
+		return
+	}
+	// Another request may have fetched the kid in the meantime
+	if _, ok := j.lookupKey(kid); ok {
+		return
+	}
+	err := j.fetchJWKS(ctx)
+	if err != nil {
+		slog.Error("unable to refresh JWKS for an unknown kid", "url", config.URL, "kid", kid, "err", err)
+	}
+}
+
+func (j *JWT) readJWKS(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create req: %w", err)
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("read JWKS from url: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to read JWKS: %d", response.StatusCode)
+	}
+
+	var jwks JWKS
+	err = json.Unmarshal(body, &jwks)
+	if err != nil {
+		return fmt.Errorf("decode JWKS: %w", err)
+	}
+	remote := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			slog.Warn("skipping JWKS key", "url", url, "kid", jwk.Kid, "err", err)
+			continue
+		}
+		remote[jwk.Kid] = key
+	}
+	if len(remote) == 0 {
+		return errors.New("no usable keys in JWKS")
+	}
+
+	j.keys.mu.Lock()
+	j.keys.remote = remote
+	j.keys.mu.Unlock()
+	return nil
+}
+
+// lookupKey returns the verification key with the given kid
+func (j *JWT) lookupKey(kid string) (crypto.PublicKey, bool) {
+	j.keys.mu.RLock()
+	defer j.keys.mu.RUnlock()
+	if key, ok := j.keys.local[kid]; ok {
+		return key, true
+	}
+	key, ok := j.keys.remote[kid]
+	return key, ok
+}
+
+// verificationKey returns the key verifying a token with the given kid (possibly empty)
+func (j *JWT) verificationKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if kid != "" {
+		if key, ok := j.lookupKey(kid); ok {
+			return key, nil
+		}
+		if signing := j.publicKey(); signing != nil && kid == j.kid() {
+			return signing, nil
+		}
+		j.refreshForKid(ctx, kid)
+		if key, ok := j.lookupKey(kid); ok {
+			return key, nil
+		}
+	}
+
+	// Without a key set, fall back to the single public key
+	if j.PublicKey != nil {
+		return j.PublicKey, nil
+	}
+	if _, isSecret := j.VerifyKey.([]byte); j.VerifyKey != nil && !isSecret {
+		return j.VerifyKey, nil
+	}
+	j.keys.mu.RLock()
+	defer j.keys.mu.RUnlock()
+	if kid == "" && len(j.keys.local)+len(j.keys.remote) == 1 {
+		for _, key := range j.keys.local {
+			return key, nil
+		}
+		for _, key := range j.keys.remote {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown kid %q", kid)
+}
+
+// publicKey returns the public key of the signing key, if any
+func (j *JWT) publicKey() crypto.PublicKey {
+	if signer, ok := j.signingKey().(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return nil
+}
+
+// kid returns the kid of the signing key: KeyID if set, otherwise its RFC 7638 thumbprint
+func (j *JWT) kid() string {
+	if j.KeyID != "" {
+		return j.KeyID
+	}
+	key := j.publicKey()
+	if key == nil {
+		return ""
+	}
+	jwk, err := NewJWK("", key)
+	if err != nil {
+		return ""
+	}
+	return jwk.Thumbprint()
+}
+
+// JWKS returns the JWKS document publishing the public part of the signing key, along with the keys added by AddPublicKey
+func (j *JWT) JWKS() (JWKS, error) {
+	jwks := JWKS{Keys: []JWK{}}
+	if key := j.publicKey(); key != nil {
+		jwk, err := NewJWK(j.kid(), key)
+		if err != nil {
+			return jwks, err
+		}
+		jwk.Alg, err = j.algorithm()
+		if err != nil {
+			return jwks, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	signingKid := j.kid()
+	j.keys.mu.RLock()
+	defer j.keys.mu.RUnlock()
+	for _, kid := range slices.Sorted(maps.Keys(j.keys.local)) {
+		if kid == signingKid {
+			continue
+		}
+		jwk, err := NewJWK(kid, j.keys.local[kid])
+		if err != nil {
+			return jwks, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks, nil
+}
+
+// JWKSHandler serves the JWKS document returned by JWKS, i.e. at /.well-known/jwks.json
+func (j *JWT) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := j.JWKS()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_ = json.NewEncoder(w).Encode(jwks)
+	})
+}
+
+// NewJWK returns the JWK of a public key, with the default algorithm of its type
+func NewJWK(kid string, key crypto.PublicKey) (JWK, error) {
+	alg, err := algorithmFor(key)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk := JWK{Use: "sig", Kid: kid, Alg: alg}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", key)
+	}
+	return jwk, nil
+}
+
+// PublicKey returns the public key described by the JWK
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode e: %w", err)
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		curve, ecdhCurve, err := jwkCurve(k.Crv)
+		if err != nil {
+			return nil, err
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decode y: %w", err)
+		}
+		// Make sure the point is on the curve
+		_, err = ecdhCurve.NewPublicKey(append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of the JWK, usable as its kid
+func (k JWK) Thumbprint() string {
+	var members string
+	switch k.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, k.E, k.Kty, k.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Crv, k.Kty, k.X, k.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, k.Crv, k.Kty, k.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// jwkCurve returns the curve named by the crv of an EC JWK
+func jwkCurve(crv string) (elliptic.Curve, ecdh.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), ecdh.P256(), nil
+	case "P-384":
+		return elliptic.P384(), ecdh.P384(), nil
+	case "P-521":
+		return elliptic.P521(), ecdh.P521(), nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+}
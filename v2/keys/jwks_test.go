@@ -0,0 +1,120 @@
+package keys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	signerA := &JWT{PrivateKey: newRSAKey(t), KeyID: "a"}
+	signerB := &JWT{PrivateKey: newRSAKey(t), KeyID: "b"}
+
+	var mu sync.Mutex
+	current := signerA
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		current.JWKSHandler().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	verifier := &JWT{}
+	verifier.StartJWKSRefresh(ctx, JWKSConfig{URL: server.URL, RefreshInterval: time.Hour, MinRefreshInterval: time.Hour})
+
+	tokenA, err := signerA.TokenFromClaims(Claims{Username: "john"})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := verifier.ParseAndValidateToken(tokenA)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// The keys are rotated, but the JWKS was just fetched: the unknown kid doesn't trigger a refresh
+	mu.Lock()
+	current = signerB
+	mu.Unlock()
+	tokenB, err := signerB.TokenFromClaims(Claims{Username: "john"})
+	require.NoError(t, err)
+	_, err = verifier.ParseAndValidateToken(tokenB)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// Once the rate limit expires, it does
+	verifier.keys.refreshMu.Lock()
+	verifier.keys.lastRefresh = time.Time{}
+	verifier.keys.refreshMu.Unlock()
+	claims, err := verifier.ParseAndValidateToken(tokenB)
+	require.NoError(t, err)
+	assert.Equal(t, "john", claims.Username)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// The old key is gone from the JWKS
+	_, err = verifier.ParseAndValidateToken(tokenA)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// The refresh is bound by the context of the request
+	verifier.keys.refreshMu.Lock()
+	verifier.keys.lastRefresh = time.Time{}
+	verifier.keys.refreshMu.Unlock()
+	requestCtx, cancelRequest := context.WithCancel(context.Background())
+	cancelRequest()
+	_, err = verifier.ParseAndValidateTokenContext(requestCtx, tokenA)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestJWKS(t *testing.T) {
+	old := newRSAKey(t)
+	signer := &JWT{PrivateKey: newRSAKey(t)}
+	signer.AddPublicKey("old", &old.PublicKey)
+
+	rec := httptest.NewRecorder()
+	signer.JWKSHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/jwk-set+json", rec.Header().Get("Content-Type"))
+
+	var jwks JWKS
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&jwks))
+	require.Len(t, jwks.Keys, 2)
+
+	// The signing key gets its thumbprint as kid
+	assert.Equal(t, jwks.Keys[0].Thumbprint(), jwks.Keys[0].Kid)
+	key, err := jwks.Keys[0].PublicKey()
+	require.NoError(t, err)
+	assert.True(t, signer.PrivateKey.PublicKey.Equal(key))
+
+	assert.Equal(t, "old", jwks.Keys[1].Kid)
+	key, err = jwks.Keys[1].PublicKey()
+	require.NoError(t, err)
+	assert.True(t, old.PublicKey.Equal(key))
+
+	// Tokens signed with the old key are still valid
+	oldSigner := &JWT{PrivateKey: old, KeyID: "old"}
+	token, err := oldSigner.TokenFromClaims(Claims{Username: "john"})
+	require.NoError(t, err)
+	_, err = signer.ParseAndValidateToken(token)
+	assert.NoError(t, err)
+
+	_, err = JWK{Kty: "oct"}.PublicKey()
+	assert.Error(t, err)
+}
@@ -3,19 +3,22 @@ package keys
 import (
 	"context"
 	"crypto/rsa"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
-	jwt "github.com/golang-jwt/jwt/v4"
+	jwt "github.com/golang-jwt/jwt/v5"
 )
 
+// Claims are the claims of the tokens issued by our auth server
 type Claims struct {
-	jwt.StandardClaims
+	jwt.RegisteredClaims
 	Role       []string               `json:"roles,omitempty"`
 	Username   string                 `json:"username,omitempty"`
 	Firstname  string                 `json:"firstname,omitempty"`
@@ -24,11 +27,56 @@ type Claims struct {
 	AppRoleMap map[string][]string    `json:"appRoleMap,omitempty"`
 	Extra      map[string]interface{} `json:"extra,omitempty"`
 	Email      string                 `json:"email,omitempty"`
+	// TokenUse is RefreshTokenUse for the refresh tokens issued by TokenService, which ParseAndValidateToken rejects
+	TokenUse string `json:"token_use,omitempty"`
+	// Family is the id shared by the refresh tokens obtained by rotating the same one
+	Family string `json:"family,omitempty"`
+}
+
+// signedClaims are the claims signed by TokenFromClaims: a single audience is marshaled as a string rather than an array,
+// like jwt/v4 StandardClaims did, so that the tokens can still be parsed by the services using it
+// It's a separate type, since a MarshalJSON method on Claims would be promoted to the structs embedding it
+type signedClaims struct {
+	Claims
+}
+
+func (c signedClaims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(c.Claims)
+	if err != nil || len(c.Audience) != 1 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	fields["aud"], err = json.Marshal(c.Audience[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
 }
 
 type JWT struct {
 	PublicKey  *rsa.PublicKey
 	PrivateKey *rsa.PrivateKey
+	// VerifyKey and SigningKey replace PublicKey and PrivateKey for the other key types: *ecdsa.PublicKey and *ecdsa.PrivateKey,
+	// ed25519.PublicKey and ed25519.PrivateKey, or the same []byte secret for HMAC (meant for internal services only)
+	VerifyKey  any
+	SigningKey any
+	// Algorithm is the algorithm signing the tokens, i.e. PS256 to use RSA-PSS: it defaults to RS256 for RSA keys,
+	// ES256, ES384 or ES512 for ECDSA ones depending on the curve, EdDSA for Ed25519 ones and HS256 for HMAC secrets
+	Algorithm string
+	// Algorithms is the allow-list of the algorithms accepted by ParseAndValidateToken, i.e. []string{"ES256"}
+	// If empty, DefaultAlgorithms and Algorithm are accepted
+	Algorithms []string
+	// Validation configures the claim checks of ParseAndValidateToken
+	Validation ValidationOptions
+	// KeyID is the kid of the signing key, set in the header of the signed tokens and in JWKS:
+	// it defaults to the RFC 7638 thumbprint of the key
+	KeyID string
+
+	keys keySet
 }
 
 var ErrInvalidToken = errors.New("invalid token")
@@ -77,35 +125,58 @@ func (j *JWT) ReadPublicKeyFromURL(url string) error {
 		return fmt.Errorf("unable to read key: %d", response.StatusCode)
 	}
 
-	j.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM([]byte(body))
-	return err
+	return j.setPublicKey(body)
 }
 
-// ReadPublicKey reads and stores a public key used to verify JWTs
+// ReadPublicKey reads and stores a public key used to verify JWTs: RSA ones are stored in PublicKey, the others in VerifyKey
 func (j *JWT) ReadPublicKey(FS fs.ReadFileFS, path string) error {
 	verifyKeyByte, err := FS.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("read public key: %w", err)
 	}
-	j.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(verifyKeyByte)
-	return err
+	return j.setPublicKey(verifyKeyByte)
 }
 
-// ReadPrivateKey reads and stores a private key used to sign JWTs
+// ReadPrivateKey reads and stores a private key used to sign JWTs: RSA ones are stored in PrivateKey, the others in SigningKey
 func (j *JWT) ReadPrivateKey(FS fs.ReadFileFS, path string) error {
 	verifyKeyByte, err := FS.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("read private key: %w", err)
 	}
-	j.PrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(verifyKeyByte)
-	return err
+	key, err := ParsePrivateKeyPEM(verifyKeyByte)
+	if err != nil {
+		return err
+	}
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		j.PrivateKey = rsaKey
+		return nil
+	}
+	j.SigningKey = key
+	return nil
+}
+
+// setPublicKey parses and stores a PEM encoded public key
+func (j *JWT) setPublicKey(data []byte) error {
+	key, err := ParsePublicKeyPEM(data)
+	if err != nil {
+		return err
+	}
+	if rsaKey, ok := key.(*rsa.PublicKey); ok {
+		j.PublicKey = rsaKey
+		return nil
+	}
+	j.VerifyKey = key
+	return nil
 }
 
 func (j *JWT) TokenFromClaims(claims Claims) (string, error) {
-	token := jwt.New(jwt.GetSigningMethod("RS256"))
-	token.Claims = claims
+	token, err := j.newToken()
+	if err != nil {
+		return "", err
+	}
+	token.Claims = signedClaims{claims}
 
-	result, err := token.SignedString(j.PrivateKey)
+	result, err := token.SignedString(j.signingKey())
 	if err != nil {
 		return "", fmt.Errorf("sign token: %w", err)
 	}
@@ -114,10 +185,13 @@ func (j *JWT) TokenFromClaims(claims Claims) (string, error) {
 }
 
 func (j *JWT) TokenFromMap(data map[string]interface{}) (string, error) {
-	token := jwt.New(jwt.GetSigningMethod("RS256"))
+	token, err := j.newToken()
+	if err != nil {
+		return "", err
+	}
 	token.Claims = jwt.MapClaims(data)
 
-	result, err := token.SignedString(j.PrivateKey)
+	result, err := token.SignedString(j.signingKey())
 	if err != nil {
 		return "", fmt.Errorf("sign token: %w", err)
 	}
@@ -125,21 +199,129 @@ func (j *JWT) TokenFromMap(data map[string]interface{}) (string, error) {
 	return result, nil
 }
 
-func (j *JWT) ParseAndValidateToken(tokenString string) (claims Claims, err error) {
-	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// newToken returns a token to be signed with the signing key
+func (j *JWT) newToken() (*jwt.Token, error) {
+	alg, err := j.algorithm()
+	if err != nil {
+		return nil, fmt.Errorf("sign token: %w", err)
+	}
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("sign token: unsupported algorithm %s", alg)
+	}
+	token := jwt.New(method)
+	if kid := j.kid(); kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token, nil
+}
+
+// signingKey returns the key signing the tokens
+func (j *JWT) signingKey() any {
+	if j.SigningKey != nil {
+		return j.SigningKey
+	}
+	if j.PrivateKey != nil {
+		return j.PrivateKey
+	}
+	return nil
+}
+
+// algorithm returns the algorithm signing the tokens
+func (j *JWT) algorithm() (string, error) {
+	if j.Algorithm != "" {
+		return j.Algorithm, nil
+	}
+	if key := j.signingKey(); key != nil {
+		return algorithmFor(key)
+	}
+	if j.VerifyKey != nil {
+		return algorithmFor(j.VerifyKey)
+	}
+	return "RS256", nil
+}
+
+// allowedAlgorithms returns the algorithms accepted by ParseAndValidateToken
+func (j *JWT) allowedAlgorithms() []string {
+	if len(j.Algorithms) > 0 {
+		return j.Algorithms
+	}
+	alg, err := j.algorithm()
+	if err != nil || slices.Contains(DefaultAlgorithms, alg) {
+		return DefaultAlgorithms
+	}
+	return append(slices.Clone(DefaultAlgorithms), alg)
+}
+
+// hmacSecret returns the secret verifying HMAC tokens
+func (j *JWT) hmacSecret() []byte {
+	if secret, ok := j.VerifyKey.([]byte); ok {
+		return secret
+	}
+	secret, _ := j.SigningKey.([]byte)
+	return secret
+}
+
+// keyFunc returns the function returning the key verifying a token, making sure it's meant for the token algorithm
+// ctx bounds the JWKS refresh triggered by an unknown kid
+func (j *JWT) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		alg := token.Method.Alg()
+		if isHMAC(alg) {
+			secret := j.hmacSecret()
+			if len(secret) == 0 {
+				return nil, fmt.Errorf("unexpected signing method: %v", alg)
+			}
+			return secret, nil
 		}
 
-		return j.PublicKey, nil
-	}, jwt.WithJSONNumber())
+		kid, _ := token.Header["kid"].(string)
+		key, err := j.verificationKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if !keyMatchesAlgorithm(key, alg) {
+			return nil, fmt.Errorf("unexpected signing method %v for key %q", alg, kid)
+		}
+		return key, nil
+	}
+}
+
+// ParseAndValidateToken parses a token, checking its signature and its claims: the returned errors wrap ErrInvalidToken
+// Refresh tokens are rejected: see TokenService.Refresh
+func (j *JWT) ParseAndValidateToken(tokenString string) (Claims, error) {
+	return j.ParseAndValidateTokenContext(context.Background(), tokenString)
+}
+
+// ParseAndValidateTokenContext is like ParseAndValidateToken, but the JWKS refresh triggered by an unknown kid
+// is bound by ctx, i.e. the context of the request carrying the token
+func (j *JWT) ParseAndValidateTokenContext(ctx context.Context, tokenString string) (Claims, error) {
+	claims, err := j.parseToken(ctx, tokenString, j.Validation)
 	if err != nil {
-		return claims, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+		return claims, err
+	}
+	if claims.TokenUse == RefreshTokenUse {
+		return claims, fmt.Errorf("%w: refresh tokens can't be used as access tokens", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// parseToken parses any token, including the refresh ones, checking its signature and validation
+func (j *JWT) parseToken(ctx context.Context, tokenString string, validation ValidationOptions) (claims Claims, err error) {
+	opts := append(validation.parserOptions(), jwt.WithJSONNumber(), jwt.WithValidMethods(j.allowedAlgorithms()))
+	token, err := jwt.NewParser(opts...).ParseWithClaims(tokenString, &claims, j.keyFunc(ctx))
+	if err != nil {
+		return claims, validationError(err)
 	}
 
 	if !token.Valid {
 		return claims, ErrInvalidToken
 	}
 
+	err = validation.validateClaims(tokenString, claims)
+	if err != nil {
+		return claims, err
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,72 @@
+package keys
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimsJSON(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	// A token as issued by our auth server with jwt/v4 StandardClaims
+	j := &JWT{SigningKey: []byte("secret")}
+	token, err := j.TokenFromMap(map[string]interface{}{
+		"sub":        "john",
+		"aud":        "api",
+		"exp":        expiresAt.Unix(),
+		"roles":      []string{"admin"},
+		"appID":      "app",
+		"appRoleMap": map[string][]string{"app": {"admin"}},
+		"extra":      map[string]interface{}{"tenant": "acme", "level": 3},
+	})
+	require.NoError(t, err)
+
+	claims, err := j.ParseAndValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "john", claims.Subject)
+	assert.Equal(t, jwt.ClaimStrings{"api"}, claims.Audience)
+	assert.Equal(t, expiresAt, claims.ExpiresAt.Time)
+	assert.Equal(t, []string{"admin"}, claims.Role)
+	assert.Equal(t, map[string][]string{"app": {"admin"}}, claims.AppRoleMap)
+	assert.Equal(t, map[string]interface{}{"tenant": "acme", "level": json.Number("3")}, claims.Extra)
+
+	// A single audience is still signed as a string
+	token, err = j.TokenFromClaims(claims)
+	require.NoError(t, err)
+	fields, err := tokenPayload(token)
+	require.NoError(t, err)
+	assert.Equal(t, "api", fields["aud"])
+	assert.Equal(t, float64(expiresAt.Unix()), fields["exp"])
+	assert.Equal(t, "john", fields["sub"])
+	assert.NotContains(t, fields, "email")
+
+	claims.Audience = jwt.ClaimStrings{"api", "web"}
+	token, err = j.TokenFromClaims(claims)
+	require.NoError(t, err)
+	fields, err = tokenPayload(token)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"api", "web"}, fields["aud"])
+
+	// The structs embedding Claims marshal their own fields too
+	data, err := json.Marshal(struct {
+		Claims
+		Tenant string `json:"tenant"`
+	}{Claims: claims, Tenant: "acme"})
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, "acme", fields["tenant"])
+	assert.Equal(t, "john", fields["sub"])
+
+	// Tokens signed from Claims round-trip
+	token, err = j.TokenFromClaims(claims)
+	require.NoError(t, err)
+	parsed, err := j.ParseAndValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, claims.Audience, parsed.Audience)
+	assert.Equal(t, claims.Role, parsed.Role)
+}
@@ -40,12 +40,13 @@ func DisableWithPrefix(prefix string) Option {
 }
 
 // Passthrough is a middleware that allows requests without authentication to pass through, setting the subject to Anonymous
+// Requests with a malformed bearer token, i.e. an empty one, are still rejected
 // WARNING: using this means you need to handle the authorization yourself
 func Passthrough() Option {
 	return func(h http.Handler, w http.ResponseWriter, r *http.Request, _ Claims, _ bool) (bool, error) {
 		_, err := getToken(r)
-		// Allow requests without authentication to pass through
-		if err != nil {
+		// Allow requests without bearer credentials to pass through
+		if errors.Is(err, errMissingAuthorization) || errors.Is(err, errUnsupportedScheme) {
 			ctx := context.WithValue(r.Context(), RequestSubjectKey, Anonymous)
 			h.ServeHTTP(w, r.WithContext(ctx))
 			return false, nil
@@ -58,7 +59,28 @@ func Passthrough() Option {
 // It returns a boolean indicating if the request should actually be processed
 type Option func(h http.Handler, w http.ResponseWriter, r *http.Request, claims Claims, beforeAuth bool) (cont bool, err error)
 
+// RequestJWTConfig configures RequestJWTWithConfig
+type RequestJWTConfig struct {
+	// ErrorWriter writes the error responses, including the ones of the options (DefaultErrorWriter if nil)
+	ErrorWriter ErrorWriter
+	// Options are the same of RequestJWT
+	Options []Option
+}
+
+// RequestJWT is a middleware authenticating the requests with the bearer token of their Authorization header
+// Errors are written by DefaultErrorWriter: see RequestJWTWithConfig to replace it
 func RequestJWT(keys *JWT, opts ...Option) func(http.Handler) http.Handler {
+	return RequestJWTWithConfig(keys, RequestJWTConfig{Options: opts})
+}
+
+// RequestJWTWithConfig is the same as RequestJWT, configured by config
+func RequestJWTWithConfig(keys *JWT, config RequestJWTConfig) func(http.Handler) http.Handler {
+	writeError := config.ErrorWriter
+	if writeError == nil {
+		writeError = DefaultErrorWriter
+	}
+	opts := config.Options
+
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -75,7 +97,7 @@ func RequestJWT(keys *JWT, opts ...Option) func(http.Handler) http.Handler {
 			for _, opt := range opts {
 				cont, err := opt(h, w, r, Claims{}, true)
 				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					writeError(w, r, http.StatusInternalServerError, err)
 					return
 				}
 				if !cont {
@@ -85,17 +107,26 @@ func RequestJWT(keys *JWT, opts ...Option) func(http.Handler) http.Handler {
 			}
 
 			token, err := getToken(r)
+			// RFC 6750 3.1: requests without bearer credentials get a challenge without error code
+			if errors.Is(err, errMissingAuthorization) || errors.Is(err, errUnsupportedScheme) {
+				w.Header().Set("WWW-Authenticate", bearerChallenge("", err))
+				writeError(w, r, http.StatusUnauthorized, err)
+				return
+			}
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusForbidden)
+				w.Header().Set("WWW-Authenticate", bearerChallenge("invalid_request", err))
+				writeError(w, r, http.StatusBadRequest, err)
 				return
 			}
 
-			t, err := keys.ParseAndValidateToken(token)
+			t, err := keys.ParseAndValidateTokenContext(r.Context(), token)
+			if errors.Is(err, ErrInvalidToken) {
+				w.Header().Set("WWW-Authenticate", bearerChallenge("invalid_token", err))
+				writeError(w, r, http.StatusUnauthorized, err)
+				return
+			}
 			if err != nil {
-				if errors.Is(err, ErrInvalidToken) {
-					http.Error(w, err.Error(), http.StatusForbidden)
-				}
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, r, http.StatusInternalServerError, err)
 				return
 			}
 
@@ -107,7 +138,7 @@ func RequestJWT(keys *JWT, opts ...Option) func(http.Handler) http.Handler {
 			for _, opt := range opts {
 				cont, err := opt(h, w, r, t, false)
 				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					writeError(w, r, http.StatusInternalServerError, err)
 					return
 				}
 				if !cont {
@@ -143,15 +174,29 @@ func TokenFromContext(ctx context.Context) string {
 	return ""
 }
 
+var (
+	errMissingAuthorization = errors.New("missing authorization header")
+	errInvalidAuthorization = errors.New("invalid authorization header")
+	errUnsupportedScheme    = errors.New("unsupported authorization scheme: a Bearer token is required")
+)
+
 func getToken(r *http.Request) (string, error) {
 	token := r.Header["Authorization"]
 	if len(token) == 0 {
-		return "", errors.New("missing authorization header")
+		return "", errMissingAuthorization
+	}
+	scheme, credentials, _ := strings.Cut(strings.TrimSpace(token[0]), " ")
+	if scheme == "" {
+		return "", errInvalidAuthorization
+	}
+	// RFC 7235 2.1: the scheme is case-insensitive
+	if !strings.EqualFold(scheme, "bearer") {
+		return "", errUnsupportedScheme
 	}
-	tok := token[0]
-	if !strings.HasPrefix(strings.ToLower(tok), "bearer ") {
-		return "", errors.New("invalid authorization header")
+	credentials = strings.TrimSpace(credentials)
+	if credentials == "" {
+		return "", errInvalidAuthorization
 	}
 
-	return strings.Split(tok, " ")[1], nil
+	return credentials, nil
 }
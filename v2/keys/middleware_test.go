@@ -0,0 +1,139 @@
+package keys
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestJWT(t *testing.T) {
+	j := &JWT{SigningKey: []byte("secret")}
+	handler := RequestJWT(j)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(SubjectFromContext(r.Context())))
+	}))
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	valid, err := j.TokenFromClaims(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "john"}})
+	require.NoError(t, err)
+	rec := serve("Bearer " + valid)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "john", rec.Body.String())
+
+	rec = serve("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	var problem huma.ErrorModel
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, huma.ErrorModel{Title: "Unauthorized", Status: http.StatusUnauthorized, Detail: "missing authorization header"}, problem)
+
+	rec = serve("Basic am9objpzZWNyZXQ=")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	// The scheme is case-insensitive
+	rec = serve("bearer " + valid)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	for _, empty := range []string{"Bearer", "Bearer ", "bearer   "} {
+		rec = serve(empty)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, empty)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_request"`, empty)
+	}
+
+	expired, err := j.TokenFromClaims(Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "john",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+	}})
+	require.NoError(t, err)
+	rec = serve("Bearer " + expired)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer error="invalid_token", error_description="invalid token: token is expired"`, rec.Header().Get("WWW-Authenticate"))
+	// A single response is written
+	problem = huma.ErrorModel{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, http.StatusUnauthorized, problem.Status)
+	assert.False(t, json.NewDecoder(rec.Body).More())
+}
+
+func TestPassthrough(t *testing.T) {
+	passthrough := Passthrough()
+	run := func(authorization string) (cont bool, subject string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subject = SubjectFromContext(r.Context())
+		})
+		cont, err := passthrough(h, httptest.NewRecorder(), req, Claims{}, true)
+		require.NoError(t, err)
+		return cont, subject
+	}
+
+	for _, anonymous := range []string{"", "Basic am9objpzZWNyZXQ="} {
+		cont, subject := run(anonymous)
+		assert.False(t, cont, anonymous)
+		assert.Equal(t, Anonymous, subject, anonymous)
+	}
+
+	// Empty bearer credentials aren't anonymous requests: they're left to the authentication, which rejects them
+	for _, authorization := range []string{"Bearer", "Bearer ", "Bearer token"} {
+		cont, subject := run(authorization)
+		assert.True(t, cont, authorization)
+		assert.Empty(t, subject, authorization)
+	}
+}
+
+func TestRequestJWTErrorWriter(t *testing.T) {
+	var written []int
+	failing := func(_ http.Handler, _ http.ResponseWriter, _ *http.Request, claims Claims, beforeAuth bool) (bool, error) {
+		if !beforeAuth && claims.Subject == "fail" {
+			return false, errors.New("boom")
+		}
+		return true, nil
+	}
+	j := &JWT{SigningKey: []byte("secret")}
+	handler := RequestJWTWithConfig(j, RequestJWTConfig{
+		ErrorWriter: func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			written = append(written, status)
+			w.WriteHeader(status)
+		},
+		Options: []Option{failing},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	token, err := j.TokenFromClaims(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "fail"}})
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusInternalServerError}, written)
+
+	// The details of internal errors aren't sent by the default writer
+	rec = httptest.NewRecorder()
+	DefaultErrorWriter(rec, req, http.StatusInternalServerError, errors.New("db password is hunter2"))
+	assert.NotContains(t, rec.Body.String(), "hunter2")
+}
@@ -0,0 +1,53 @@
+package keys
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationStore stores the ids of the revoked tokens, until they expire
+type RevocationStore interface {
+	// Revoke revokes id until expiresAt, reporting whether it was already revoked
+	// It must be atomic, as TokenService relies on it to detect the reuse of refresh tokens
+	Revoke(ctx context.Context, id string, expiresAt time.Time) (alreadyRevoked bool, err error)
+	// IsRevoked reports whether id is revoked
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// MemoryRevocationStore is a RevocationStore for a single instance, i.e. in tests or development
+// See the sqlstore package for a RevocationStore shared by multiple instances
+type MemoryRevocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryRevocationStore returns an empty MemoryRevocationStore
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{revoked: map[string]time.Time{}}
+}
+
+func (s *MemoryRevocationStore) Revoke(_ context.Context, id string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Forget the expired ids, so the store doesn't grow forever
+	t := now()
+	for revoked, exp := range s.revoked {
+		if exp.Before(t) {
+			delete(s.revoked, revoked)
+		}
+	}
+
+	if _, ok := s.revoked[id]; ok {
+		return true, nil
+	}
+	s.revoked[id] = expiresAt
+	return false, nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.revoked[id]
+	return ok, nil
+}
@@ -0,0 +1,67 @@
+// Package sqlstore stores the revoked tokens of keys.TokenService in a SQL table, so that multiple instances can share them
+// It's a separate package so that keys doesn't depend on dbutils and its drivers
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/top-solution/go-libs/v2/dbutils"
+)
+
+// RevocationStore is a keys.RevocationStore backed by a table such as:
+//
+//	CREATE TABLE revoked_tokens (
+//		id VARCHAR(64) NOT NULL PRIMARY KEY,
+//		expires_at TIMESTAMP NOT NULL
+//	);
+//
+// The queries run in the transaction from the context, if any
+type RevocationStore struct {
+	db     dbutils.ContextExecutor
+	driver dbutils.DriverType
+	table  string
+}
+
+// NewRevocationStore returns a RevocationStore on table, i.e. NewRevocationStore(db, db.DriverType(), "revoked_tokens")
+func NewRevocationStore(db dbutils.ContextExecutor, driver dbutils.DriverType, table string) *RevocationStore {
+	return &RevocationStore{db: db, driver: driver, table: driver.Quote(table)}
+}
+
+func (s *RevocationStore) Revoke(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	var query string
+	switch s.driver {
+	case dbutils.MSSQLDriver:
+		query = fmt.Sprintf("INSERT INTO %[1]s (id, expires_at) SELECT @p1, @p2 WHERE NOT EXISTS (SELECT 1 FROM %[1]s WITH (UPDLOCK, HOLDLOCK) WHERE id = @p1)", s.table)
+	default:
+		query = fmt.Sprintf("INSERT INTO %s (id, expires_at) VALUES (%s, %s) ON CONFLICT (id) DO NOTHING", s.table, s.driver.Placeholder(1), s.driver.Placeholder(2))
+	}
+	result, err := dbutils.TxOr(ctx, s.db).ExecContext(ctx, query, id, expiresAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("revoke token: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("revoke token: %w", err)
+	}
+	return inserted == 0, nil
+}
+
+func (s *RevocationStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	var count int
+	err := dbutils.TxOr(ctx, s.db).QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id = %s", s.table, s.driver.Placeholder(1)), id).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("check token revocation: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Purge deletes the expired revocations, returning how many were deleted: it's meant to be run periodically
+func (s *RevocationStore) Purge(ctx context.Context) (int64, error) {
+	result, err := dbutils.TxOr(ctx, s.db).ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at < %s", s.table, s.driver.Placeholder(1)), time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("purge revoked tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
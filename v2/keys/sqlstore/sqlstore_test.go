@@ -0,0 +1,52 @@
+package sqlstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/top-solution/go-libs/v2/dbutils"
+	"github.com/top-solution/go-libs/v2/internal/testutil"
+	"github.com/top-solution/go-libs/v2/keys"
+)
+
+func TestRevocationStore(t *testing.T) {
+	db := testutil.OpenSQLite(t, "CREATE TABLE revoked_tokens (id VARCHAR(64) NOT NULL PRIMARY KEY, expires_at TIMESTAMP NOT NULL)")
+
+	ctx := context.Background()
+	store := NewRevocationStore(db, dbutils.SQLiteDriver, "revoked_tokens")
+
+	already, err := store.Revoke(ctx, "a", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, already)
+	already, err = store.Revoke(ctx, "a", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, already)
+
+	revoked, err := store.IsRevoked(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = store.IsRevoked(ctx, "b")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	_, err = store.Revoke(ctx, "expired", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	purged, err := store.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	revoked, err = store.IsRevoked(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// The token service works on top of it
+	service := keys.NewTokenService(&keys.JWT{SigningKey: []byte("secret")}, keys.TokenServiceConfig{Store: store})
+	pair, err := service.Issue(ctx, keys.Claims{Username: "john"})
+	require.NoError(t, err)
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, keys.ErrTokenReused)
+}
@@ -0,0 +1,219 @@
+package keys
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// RefreshTokenUse is the token_use claim of the refresh tokens
+const RefreshTokenUse = "refresh"
+
+// DefaultRefreshAudience is the default aud claim of the refresh tokens
+const DefaultRefreshAudience = "refresh-token"
+
+var (
+	// ErrTokenRevoked is returned when refreshing a revoked token
+	ErrTokenRevoked = fmt.Errorf("%w: token is revoked", ErrInvalidToken)
+	// ErrTokenReused is returned when refreshing a refresh token that was already used: the whole family is revoked,
+	// since either the client or an attacker holds a stolen token
+	ErrTokenReused = fmt.Errorf("%w: refresh token reused", ErrTokenRevoked)
+)
+
+// TokenServiceConfig configures a TokenService
+type TokenServiceConfig struct {
+	// AccessTokenTTL is the lifetime of the access tokens (15 minutes if zero)
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is the lifetime of the refresh tokens (30 days if zero): each refresh restarts it
+	RefreshTokenTTL time.Duration
+	// Issuer, if set, is the iss claim of the issued tokens
+	Issuer string
+	// Audience, if set, is the aud claim of the access tokens
+	Audience []string
+	// RefreshAudience is the aud claim of the refresh tokens (DefaultRefreshAudience if empty): it must differ from Audience,
+	// so that the services verifying the access tokens reject the refresh ones, which are signed by the same key
+	RefreshAudience string
+	// Store stores the used and revoked refresh tokens (a MemoryRevocationStore if nil, which only works with a single instance)
+	Store RevocationStore
+	// Reload, if set, is called on refresh to update the claims, i.e. the roles of the user, or to reject the refresh
+	// returning an error, i.e. when the user was disabled
+	Reload func(ctx context.Context, claims Claims) (Claims, error)
+}
+
+// TokenPair is a pair of access and refresh tokens, marshaled like an OAuth 2.0 token response
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token, in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// TokenService issues short-lived access tokens along with long-lived refresh tokens, signed by a JWT
+// Refresh tokens are rotated on use: using one twice revokes all the tokens obtained from it
+type TokenService struct {
+	jwt    *JWT
+	config TokenServiceConfig
+}
+
+// NewTokenService returns a TokenService signing the tokens with j
+func NewTokenService(j *JWT, config TokenServiceConfig) *TokenService {
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = 15 * time.Minute
+	}
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRevocationStore()
+	}
+	if config.RefreshAudience == "" {
+		config.RefreshAudience = DefaultRefreshAudience
+	}
+	return &TokenService{jwt: j, config: config}
+}
+
+// Issue issues a new pair of tokens for claims, i.e. after a login
+func (s *TokenService) Issue(ctx context.Context, claims Claims) (TokenPair, error) {
+	family, err := newTokenID()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return s.issue(claims, family)
+}
+
+// Refresh issues a new pair of tokens from a refresh token, which can't be used anymore
+// It returns ErrTokenReused if the token was already used, revoking all the tokens of its family
+func (s *TokenService) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	claims, err := s.refreshClaims(ctx, refreshToken)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	alreadyUsed, err := s.config.Store.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if alreadyUsed {
+		// Every token of the family expires before the last one issued now would
+		_, err = s.config.Store.Revoke(ctx, claims.Family, now().Add(s.config.RefreshTokenTTL))
+		if err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrTokenReused
+	}
+
+	// Reload may return brand new claims: the new pair belongs to the family of the refresh token anyway
+	family := claims.Family
+	if s.config.Reload != nil {
+		claims, err = s.config.Reload(ctx, claims)
+		if err != nil {
+			return TokenPair{}, fmt.Errorf("reload claims: %w", err)
+		}
+	}
+	return s.issue(claims, family)
+}
+
+// Revoke revokes a refresh token along with all the tokens of its family, i.e. on logout
+// The access tokens already issued stay valid until they expire
+func (s *TokenService) Revoke(ctx context.Context, refreshToken string) error {
+	claims, err := s.refreshClaims(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	_, err = s.config.Store.Revoke(ctx, claims.Family, now().Add(s.config.RefreshTokenTTL))
+	return err
+}
+
+// refreshValidation returns the checks of the refresh tokens: unlike the access tokens, they must have the refresh audience,
+// while MaxAge, AppID and the required claims of the JWT validation options don't apply to them
+func (s *TokenService) refreshValidation() ValidationOptions {
+	issuers := s.jwt.Validation.Issuers
+	if s.config.Issuer != "" {
+		issuers = []string{s.config.Issuer}
+	}
+	return ValidationOptions{
+		Issuers:        issuers,
+		Audience:       s.config.RefreshAudience,
+		Leeway:         s.jwt.Validation.Leeway,
+		RequiredClaims: []string{"exp", "jti"},
+	}
+}
+
+// refreshClaims validates a refresh token, returning its claims
+func (s *TokenService) refreshClaims(ctx context.Context, refreshToken string) (Claims, error) {
+	claims, err := s.jwt.parseToken(ctx, refreshToken, s.refreshValidation())
+	if err != nil {
+		return claims, err
+	}
+	if claims.TokenUse != RefreshTokenUse || claims.ID == "" || claims.Family == "" || claims.ExpiresAt == nil {
+		return claims, fmt.Errorf("%w: not a refresh token", ErrInvalidToken)
+	}
+
+	revoked, err := s.config.Store.IsRevoked(ctx, claims.Family)
+	if err != nil {
+		return claims, err
+	}
+	if revoked {
+		return claims, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// issue signs a new pair of tokens of the given family
+func (s *TokenService) issue(claims Claims, family string) (TokenPair, error) {
+	issuedAt := now()
+
+	access, err := s.sign(claims, "", "", issuedAt, s.config.AccessTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := s.sign(claims, RefreshTokenUse, family, issuedAt, s.config.RefreshTokenTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (s *TokenService) sign(claims Claims, use, family string, issuedAt time.Time, ttl time.Duration) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	claims.ID = id
+	claims.TokenUse = use
+	claims.Family = family
+	claims.IssuedAt = jwt.NewNumericDate(issuedAt)
+	claims.NotBefore = nil
+	claims.ExpiresAt = jwt.NewNumericDate(issuedAt.Add(ttl))
+	if s.config.Issuer != "" {
+		claims.Issuer = s.config.Issuer
+	}
+	switch {
+	case use == RefreshTokenUse:
+		claims.Audience = []string{s.config.RefreshAudience}
+	case len(s.config.Audience) > 0:
+		claims.Audience = s.config.Audience
+	}
+	return s.jwt.TokenFromClaims(claims)
+}
+
+// newTokenID returns a random token id
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generate token id: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,154 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenService(t *testing.T) {
+	ctx := context.Background()
+	j := &JWT{SigningKey: []byte("secret")}
+	reloads := 0
+	service := NewTokenService(j, TokenServiceConfig{
+		Issuer:   "https://auth.example.com",
+		Audience: []string{"api"},
+		Reload: func(ctx context.Context, claims Claims) (Claims, error) {
+			reloads++
+			if claims.Username == "disabled" {
+				return claims, errors.New("user disabled")
+			}
+			claims.Role = []string{"admin"}
+			return claims, nil
+		},
+	})
+
+	pair, err := service.Issue(ctx, Claims{Username: "john"})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, 900, pair.ExpiresIn)
+
+	claims, err := j.ParseAndValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "john", claims.Username)
+	assert.Equal(t, "https://auth.example.com", claims.Issuer)
+	assert.Equal(t, 15*time.Minute, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+
+	// Refresh tokens aren't access tokens, and vice versa
+	_, err = j.ParseAndValidateToken(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = service.Refresh(ctx, pair.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	refreshed, err := service.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reloads)
+	claims, err = j.ParseAndValidateToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, claims.Role)
+
+	// Reusing the first refresh token revokes the whole family, including the rotated token
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenReused)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = service.Refresh(ctx, refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	// Other families are not affected, until revoked
+	other, err := service.Issue(ctx, Claims{Username: "jane"})
+	require.NoError(t, err)
+	other, err = service.Refresh(ctx, other.RefreshToken)
+	require.NoError(t, err)
+	require.NoError(t, service.Revoke(ctx, other.RefreshToken))
+	_, err = service.Refresh(ctx, other.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	disabled, err := service.Issue(ctx, Claims{Username: "disabled"})
+	require.NoError(t, err)
+	_, err = service.Refresh(ctx, disabled.RefreshToken)
+	assert.ErrorContains(t, err, "user disabled")
+}
+
+func TestTokenServiceFreshReloadedClaims(t *testing.T) {
+	ctx := context.Background()
+	j := &JWT{SigningKey: []byte("secret")}
+	service := NewTokenService(j, TokenServiceConfig{
+		Reload: func(ctx context.Context, claims Claims) (Claims, error) {
+			return Claims{Username: claims.Username, Role: []string{"admin"}}, nil
+		},
+	})
+
+	pair, err := service.Issue(ctx, Claims{Username: "john"})
+	require.NoError(t, err)
+	refreshed, err := service.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	refreshed, err = service.Refresh(ctx, refreshed.RefreshToken)
+	require.NoError(t, err)
+
+	// The rotated tokens still belong to the family of the first one
+	_, err = service.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenReused)
+	_, err = service.Refresh(ctx, refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestTokenServiceRefreshValidation(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	ctx := context.Background()
+	j := &JWT{SigningKey: []byte("secret"), Validation: ValidationOptions{
+		Audience:       "api",
+		MaxAge:         time.Hour,
+		AppID:          "app",
+		RequiredClaims: []string{"appID"},
+	}}
+	service := NewTokenService(j, TokenServiceConfig{Audience: []string{"api"}})
+
+	pair, err := service.Issue(ctx, Claims{Username: "john", AppID: "app"})
+	require.NoError(t, err)
+	_, err = j.ParseAndValidateToken(pair.AccessToken)
+	require.NoError(t, err)
+
+	// Refresh tokens have their own audience, which the services expecting the access tokens one reject
+	_, err = j.ParseAndValidateToken(pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidAudience)
+
+	// MaxAge only applies to the access tokens
+	current = current.Add(2 * time.Hour)
+	_, err = j.ParseAndValidateToken(pair.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	refreshed, err := service.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	claims, err := j.ParseAndValidateToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "john", claims.Username)
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+
+	already, err := store.Revoke(ctx, "a", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, already)
+	already, err = store.Revoke(ctx, "a", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, already)
+
+	_, err = store.Revoke(ctx, "expired", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = store.Revoke(ctx, "b", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	revoked, err := store.IsRevoked(ctx, "expired")
+	require.NoError(t, err)
+	assert.False(t, revoked, "expired revocations are forgotten")
+	revoked, err = store.IsRevoked(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
@@ -0,0 +1,120 @@
+package keys
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// The errors returned by ParseAndValidateToken for the failed checks: they all wrap ErrInvalidToken
+var (
+	ErrTokenExpired     = fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	ErrTokenNotValidYet = fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	ErrTokenTooOld      = fmt.Errorf("%w: token is too old", ErrInvalidToken)
+	ErrInvalidIssuer    = fmt.Errorf("%w: invalid issuer", ErrInvalidToken)
+	ErrInvalidAudience  = fmt.Errorf("%w: invalid audience", ErrInvalidToken)
+	ErrInvalidAppID     = fmt.Errorf("%w: invalid app id", ErrInvalidToken)
+	ErrMissingClaim     = fmt.Errorf("%w: missing required claim", ErrInvalidToken)
+)
+
+// ValidationOptions configures the claim checks of ParseAndValidateToken, on top of the signature one
+type ValidationOptions struct {
+	// Issuers, if set, are the accepted values of the iss claim
+	Issuers []string
+	// Audience, if set, must be one of the values of the aud claim
+	Audience string
+	// Leeway is the clock skew tolerated when checking the exp, nbf and iat claims
+	Leeway time.Duration
+	// MaxAge, if set, rejects the tokens issued longer ago, along with the ones without an iat claim
+	MaxAge time.Duration
+	// RequiredClaims are the claims that must be set and not empty, by JSON name, i.e. []string{"exp", "email"}
+	RequiredClaims []string
+	// AppID, if set, rejects the tokens issued for another service: tokens without an appID claim are still accepted,
+	// unless "appID" is one of the RequiredClaims
+	AppID string
+}
+
+// now is replaced in tests
+var now = time.Now
+
+// parserOptions returns the options of the jwt parser running the standard checks of options: exp, nbf, iat, aud and a single iss
+func (o ValidationOptions) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{jwt.WithLeeway(o.Leeway), jwt.WithIssuedAt(), jwt.WithTimeFunc(now)}
+	if o.Audience != "" {
+		opts = append(opts, jwt.WithAudience(o.Audience))
+	}
+	if len(o.Issuers) == 1 {
+		opts = append(opts, jwt.WithIssuer(o.Issuers[0]))
+	}
+	if slices.Contains(o.RequiredClaims, "exp") {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+	return opts
+}
+
+// validationError maps the errors of the jwt parser to ours
+func validationError(err error) error {
+	for _, mapping := range []struct{ jwtErr, err error }{
+		{jwt.ErrTokenExpired, ErrTokenExpired},
+		{jwt.ErrTokenNotValidYet, ErrTokenNotValidYet},
+		{jwt.ErrTokenUsedBeforeIssued, ErrTokenNotValidYet},
+		{jwt.ErrTokenInvalidAudience, ErrInvalidAudience},
+		{jwt.ErrTokenInvalidIssuer, ErrInvalidIssuer},
+		{jwt.ErrTokenRequiredClaimMissing, ErrMissingClaim},
+	} {
+		if errors.Is(err, mapping.jwtErr) {
+			return mapping.err
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+}
+
+// validateClaims runs the checks of options not covered by the jwt parser on the claims of a valid token
+func (o ValidationOptions) validateClaims(tokenString string, claims Claims) error {
+	if o.MaxAge > 0 && (claims.IssuedAt == nil || now().Sub(claims.IssuedAt.Time) > o.MaxAge+o.Leeway) {
+		return ErrTokenTooOld
+	}
+	if len(o.Issuers) > 1 && !slices.Contains(o.Issuers, claims.Issuer) {
+		return fmt.Errorf("%w %q", ErrInvalidIssuer, claims.Issuer)
+	}
+	if o.AppID != "" && claims.AppID != "" && claims.AppID != o.AppID {
+		return fmt.Errorf("%w %q", ErrInvalidAppID, claims.AppID)
+	}
+
+	if len(o.RequiredClaims) > 0 {
+		payload, err := tokenPayload(tokenString)
+		if err != nil {
+			return err
+		}
+		for _, claim := range o.RequiredClaims {
+			if value, ok := payload[claim]; !ok || value == nil || value == "" {
+				return fmt.Errorf("%w %s", ErrMissingClaim, claim)
+			}
+		}
+	}
+	return nil
+}
+
+// tokenPayload decodes the claims of a token as a map, to tell the missing claims apart from the zero ones
+func tokenPayload(tokenString string) (map[string]any, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode claims: %s", ErrInvalidToken, err.Error())
+	}
+	var payload map[string]any
+	err = json.Unmarshal(data, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode claims: %s", ErrInvalidToken, err.Error())
+	}
+	return payload, nil
+}
@@ -0,0 +1,92 @@
+package keys
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidation(t *testing.T) {
+	current := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+	at := func(d time.Duration) *jwt.NumericDate { return jwt.NewNumericDate(current.Add(d)) }
+
+	valid := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "john",
+			Issuer:    "https://auth.example.com",
+			Audience:  jwt.ClaimStrings{"api"},
+			IssuedAt:  at(-time.Minute),
+			ExpiresAt: at(time.Hour),
+		},
+		AppID: "app",
+		Email: "john@example.com",
+	}
+	options := ValidationOptions{
+		Issuers:        []string{"https://auth.example.com"},
+		Audience:       "api",
+		Leeway:         30 * time.Second,
+		MaxAge:         time.Hour,
+		RequiredClaims: []string{"sub", "email"},
+		AppID:          "app",
+	}
+
+	for _, test := range []struct {
+		name    string
+		edit    func(c *Claims)
+		options func(o *ValidationOptions)
+		err     error
+	}{
+		{name: "valid"},
+		{name: "expired", edit: func(c *Claims) { c.ExpiresAt = at(-time.Minute) }, err: ErrTokenExpired},
+		{name: "expired within leeway", edit: func(c *Claims) { c.ExpiresAt = at(-10 * time.Second) }},
+		{name: "not valid yet", edit: func(c *Claims) { c.NotBefore = at(time.Minute) }, err: ErrTokenNotValidYet},
+		{name: "not valid yet within leeway", edit: func(c *Claims) { c.NotBefore = at(10 * time.Second) }},
+		{name: "issued in the future", edit: func(c *Claims) { c.IssuedAt = at(time.Minute) }, err: ErrTokenNotValidYet},
+		{name: "too old", edit: func(c *Claims) { c.IssuedAt = at(-2 * time.Hour) }, err: ErrTokenTooOld},
+		{name: "no iat with max age", edit: func(c *Claims) { c.IssuedAt = nil }, err: ErrTokenTooOld},
+		{name: "wrong issuer", edit: func(c *Claims) { c.Issuer = "https://evil.example.com" }, err: ErrInvalidIssuer},
+		{name: "wrong audience", edit: func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }, err: ErrInvalidAudience},
+		{name: "wrong app id", edit: func(c *Claims) { c.AppID = "other" }, err: ErrInvalidAppID},
+		{name: "no app id", edit: func(c *Claims) { c.AppID = "" }},
+		{name: "required app id", edit: func(c *Claims) { c.AppID = "" }, options: func(o *ValidationOptions) {
+			o.RequiredClaims = append(o.RequiredClaims, "appID")
+		}, err: ErrMissingClaim},
+		{name: "one of the issuers", edit: func(c *Claims) { c.Issuer = "https://old.example.com" }, options: func(o *ValidationOptions) {
+			o.Issuers = append(o.Issuers, "https://old.example.com")
+		}},
+		{name: "none of the issuers", edit: func(c *Claims) { c.Issuer = "https://evil.example.com" }, options: func(o *ValidationOptions) {
+			o.Issuers = append(o.Issuers, "https://old.example.com")
+		}, err: ErrInvalidIssuer},
+		{name: "required exp", edit: func(c *Claims) { c.ExpiresAt = nil }, options: func(o *ValidationOptions) {
+			o.RequiredClaims = append(o.RequiredClaims, "exp")
+		}, err: ErrMissingClaim},
+		{name: "missing claim", edit: func(c *Claims) { c.Email = "" }, err: ErrMissingClaim},
+		{name: "no options", edit: func(c *Claims) { *c = Claims{} }, options: func(o *ValidationOptions) { *o = ValidationOptions{} }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			claims := valid
+			if test.edit != nil {
+				test.edit(&claims)
+			}
+			j := &JWT{SigningKey: []byte("secret"), Validation: options}
+			if test.options != nil {
+				test.options(&j.Validation)
+			}
+			token, err := j.TokenFromClaims(claims)
+			require.NoError(t, err)
+
+			_, err = j.ParseAndValidateToken(token)
+			if test.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, test.err)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
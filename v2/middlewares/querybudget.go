@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"cmp"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/top-solution/go-libs/v2/dbutils/querystats"
+)
+
+// QueryBudgetConfig configures the QueryBudget middleware
+type QueryBudgetConfig struct {
+	// MaxQueries is the number of queries a single request can run before a warning is logged: 0 disables the check
+	MaxQueries int
+	// MaxRepeated is the number of times a single request can run the same normalized statement before a warning is logged,
+	// which usually means an N+1 pattern: 0 disables the check
+	MaxRepeated int
+	// Logger is used to log the warnings (slog.Default() if nil)
+	Logger *slog.Logger
+	// Skip, if set, disables the checks for the matching requests
+	Skip RequestCondition
+}
+
+// QueryBudget is a development middleware that counts the queries run by each request, logging a warning when the request
+// exceeds the budget or runs the same statement too many times
+// Queries are only counted when run through an executor wrapped by dbutils.Instrumenter, with the request context:
+// the middleware itself only depends on dbutils/querystats
+func QueryBudget(config QueryBudgetConfig) func(http.Handler) http.Handler {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	skip := config.Skip
+	if skip == nil {
+		skip = NeverCondition
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, stats := querystats.NewContext(r.Context())
+			start := time.Now()
+			h.ServeHTTP(w, r.WithContext(ctx))
+
+			count := stats.Count()
+			repeated := repeatedStatements(stats.Statements(), config.MaxRepeated)
+			if len(repeated) == 0 && (config.MaxQueries <= 0 || count <= config.MaxQueries) {
+				return
+			}
+
+			attrs := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"queries", count,
+				"queries_duration", stats.Duration(),
+				"elapsed", time.Since(start),
+			}
+			if len(repeated) > 0 {
+				attrs = append(attrs, "repeated", repeated)
+				logger.WarnContext(r.Context(), "request repeats the same query: possible N+1", attrs...)
+				return
+			}
+			logger.WarnContext(r.Context(), "request exceeds the query budget", attrs...)
+		})
+	}
+}
+
+// repeatedStatement is a statement run more than the allowed number of times by a single request
+type repeatedStatement struct {
+	Query string `json:"query"`
+	Count int    `json:"count"`
+}
+
+// repeatedStatements returns the statements run more than max times, most repeated first
+func repeatedStatements(statements map[string]int, max int) []repeatedStatement {
+	if max <= 0 {
+		return nil
+	}
+	var result []repeatedStatement
+	for _, query := range slices.Sorted(maps.Keys(statements)) {
+		if statements[query] > max {
+			result = append(result, repeatedStatement{Query: query, Count: statements[query]})
+		}
+	}
+	slices.SortStableFunc(result, func(a, b repeatedStatement) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	return result
+}
@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/top-solution/go-libs/v2/dbutils/querystats"
+)
+
+func TestQueryBudget(t *testing.T) {
+	var logs bytes.Buffer
+	middleware := QueryBudget(QueryBudgetConfig{
+		MaxQueries:  5,
+		MaxRepeated: 2,
+		Logger:      slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+
+	serve := func(queries ...string) {
+		logs.Reset()
+		h := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, q := range queries {
+				querystats.FromContext(r.Context()).Record(q, time.Millisecond)
+			}
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/owners", nil))
+	}
+
+	serve("SELECT * FROM owners", "SELECT * FROM pets WHERE owner_id = $1")
+	assert.Empty(t, logs.String())
+
+	serve("SELECT * FROM owners", "SELECT * FROM pets WHERE owner_id = $1", "SELECT * FROM pets WHERE owner_id = $1", "SELECT * FROM pets WHERE owner_id = $1")
+	assert.Contains(t, logs.String(), "possible N+1")
+	assert.Contains(t, logs.String(), "SELECT * FROM pets WHERE owner_id = ?")
+	assert.Contains(t, logs.String(), "queries=4")
+
+	serve("SELECT 1 FROM a", "SELECT 1 FROM b", "SELECT 1 FROM c", "SELECT 1 FROM d", "SELECT 1 FROM e", "SELECT 1 FROM f")
+	assert.Contains(t, logs.String(), "exceeds the query budget")
+	assert.Contains(t, logs.String(), "queries=6")
+}